@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxSuggestionCacheEntries = 10_000
+
+type suggestionCacheEntry struct {
+	suggestions []*data.Suggestion
+	expires     time.Time
+}
+
+// suggestionCache keeps the suggestions of the prefixes typed recently, most
+// clients type the same first letters.
+type suggestionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]suggestionCacheEntry
+}
+
+func newSuggestionCache(ttl time.Duration) *suggestionCache {
+	return &suggestionCache{ttl: ttl, entries: make(map[string]suggestionCacheEntry)}
+}
+
+func (sc *suggestionCache) get(key string) ([]*data.Suggestion, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	entry, ok := sc.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.suggestions, true
+}
+
+func (sc *suggestionCache) set(key string, suggestions []*data.Suggestion) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := time.Now()
+
+	if len(sc.entries) >= maxSuggestionCacheEntries {
+		for k, entry := range sc.entries {
+			if now.After(entry.expires) {
+				delete(sc.entries, k)
+			}
+		}
+	}
+	// still full of live entries, drop some at random to make room
+	for k := range sc.entries {
+		if len(sc.entries) < maxSuggestionCacheEntries {
+			break
+		}
+		delete(sc.entries, k)
+	}
+
+	sc.entries[key] = suggestionCacheEntry{suggestions: suggestions, expires: now.Add(sc.ttl)}
+}
+
+func (app *application) autocompleteHandler(c echo.Context) error {
+	v := validator.New()
+
+	q := strings.TrimSpace(c.QueryParam("q"))
+	types := app.readCSV(c.QueryParams(), "types", data.SuggestionTypes)
+	limit := app.readInt(c.QueryParams(), "limit", 10, v)
+
+	v.Check(q != "", "q", validator.CodeRequired, "q must be provided")
+	v.Check(validator.MaxChars(q, 100), "q", validator.CodeTooLong, "q should be less than or equal to 100 characters long")
+	v.Check(limit >= 1 && limit <= 20, "limit", validator.CodeOutOfRange, "limit must be between 1 and 20")
+	data.ValidateFields(v, "types", types, data.SuggestionTypes)
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	key := fmt.Sprintf("%s|%s|%d", strings.ToLower(q), strings.Join(types, ","), limit)
+
+	suggestions, ok := app.suggestions.get(key)
+	if !ok {
+		var err error
+		suggestions, err = app.models.Suggestions.Get(q, types, limit)
+		if err != nil {
+			return err
+		}
+		app.suggestions.set(key, suggestions)
+	}
+
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(app.config.autocomplete.cacheTTL.Seconds())))
+
+	return c.JSON(http.StatusOK, envelope{"message": "Suggestions returned successfully", "suggestions": suggestions})
+}
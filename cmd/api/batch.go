@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxBatchSize = 100
+
+func (app *application) batchGetMoviesHandler(c echo.Context) error {
+	var input struct {
+		IDs []int `json:"ids"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return app.batchGetMovies(c, input.IDs)
+}
+
+// batchGetMovies answers both POST /v1/movies/batch-get and GET /v1/movies?ids=,
+// embedding the same details as showMovieHandler.
+func (app *application) batchGetMovies(c echo.Context, ids []int) error {
+	v := validator.New()
+
+	v.Check(len(ids) > 0, "ids", validator.CodeRequired, "ids must contain at least one id")
+	v.Check(len(ids) <= maxBatchSize, "ids", validator.CodeTooLong, fmt.Sprintf("ids must not contain more than %d ids", maxBatchSize))
+	for _, id := range ids {
+		v.Check(id > 0, "ids", validator.CodeOutOfRange, "ids must be positive integers")
+	}
+
+	view := app.readMovieView(c.QueryParams(), v, append(movieDetails, "trailer")...)
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	unique := make([]int, 0, len(ids))
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	movies, err := app.models.Movies.GetMany(unique, view.fields...)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[int]bool, len(movies))
+	for _, movie := range movies {
+		found[movie.ID] = true
+	}
+	missing := []int{}
+	for _, id := range unique {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	err = app.loadMovieDetails(c, view, movies...)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := view.renderAll(movies)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Movies returned successfully", "movies": rendered, "missing": missing})
+}
+
+type batchOperationInput struct {
+	Op      string          `json:"op"`
+	ID      int             `json:"id"`
+	Version *int32          `json:"version"`
+	Movie   json.RawMessage `json:"movie"`
+}
+
+type batchResult struct {
+	Op     string                 `json:"op"`
+	Status int                    `json:"status"`
+	ID     int                    `json:"id,omitempty"`
+	Movie  *data.Movie            `json:"movie,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+	Errors []validator.FieldError `json:"errors,omitempty"`
+}
+
+func (app *application) batchWriteMoviesHandler(c echo.Context) error {
+	var input struct {
+		Atomic     *bool                  `json:"atomic"`
+		Operations []*batchOperationInput `json:"operations"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Operations) > 0, "operations", validator.CodeRequired, "operations must contain at least one operation")
+	v.Check(len(input.Operations) <= maxBatchSize, "operations", validator.CodeTooLong, fmt.Sprintf("operations must not contain more than %d operations", maxBatchSize))
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	atomic := input.Atomic == nil || *input.Atomic
+
+	ops := make([]*data.BatchOperation, len(input.Operations))
+	results := make([]*batchResult, len(input.Operations))
+
+	for i, in := range input.Operations {
+		ops[i], results[i] = app.prepareBatchOperation(in)
+	}
+
+	user := app.contextGetUser(c)
+
+	err := app.models.Movies.Batch(ops, atomic, user.ID)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	status := http.StatusOK
+	for i, op := range ops {
+		result := results[i]
+		switch {
+		case result.Status != 0:
+		case op.Err != nil:
+			result.Status, result.Error, result.Errors = batchErrorStatus(op.Err)
+		case !op.Done:
+			result.Status = http.StatusFailedDependency
+			result.Error = "not applied because another operation of the atomic batch failed"
+		case op.Op == data.BatchCreate:
+			result.Status = http.StatusCreated
+			result.ID = op.Movie.ID
+			result.Movie = op.Movie
+		case op.Op == data.BatchUpdate:
+			result.Status = http.StatusOK
+			result.Movie = op.Movie
+		default:
+			result.Status = http.StatusOK
+		}
+
+		if result.Status >= 400 && result.Status != http.StatusFailedDependency {
+			failed++
+			if atomic && status == http.StatusOK {
+				status = result.Status
+			}
+		}
+	}
+
+	message := "Batch applied successfully"
+	switch {
+	case failed > 0 && atomic:
+		message = "Batch rolled back, no operation was applied"
+	case failed > 0:
+		message = fmt.Sprintf("Batch applied with %d failed operations", failed)
+	}
+
+	return c.JSON(status, envelope{"message": message, "atomic": atomic, "results": results})
+}
+
+// prepareBatchOperation decodes and validates an operation. Operations that
+// can't run get a result with their status set and an error so the batch
+// leaves them out.
+func (app *application) prepareBatchOperation(in *batchOperationInput) (*data.BatchOperation, *batchResult) {
+	op := &data.BatchOperation{Op: in.Op, ID: in.ID, Version: in.Version}
+	result := &batchResult{Op: in.Op, ID: in.ID}
+
+	fail := func(status int, err error, errors []validator.FieldError) (*data.BatchOperation, *batchResult) {
+		op.Err = err
+		result.Status = status
+		result.Error = err.Error()
+		result.Errors = errors
+		return op, result
+	}
+
+	v := validator.New()
+
+	switch in.Op {
+	case data.BatchCreate:
+		var movie createMovieInput
+		if err := json.Unmarshal(in.Movie, &movie); err != nil {
+			return fail(http.StatusBadRequest, err, nil)
+		}
+		op.Movie = movie.movie()
+
+	case data.BatchUpdate, data.BatchDelete:
+		if in.ID < 1 {
+			v.AddError("id", validator.CodeRequired, "id must be provided and a positive integer")
+			return fail(http.StatusUnprocessableEntity, errors.New("invalid operation"), v.FieldErrors())
+		}
+		if in.Op == data.BatchDelete {
+			return op, result
+		}
+		if in.Version == nil {
+			v.AddError("version", validator.CodeRequired, "version must be provided for updates")
+			return fail(http.StatusUnprocessableEntity, errors.New("invalid operation"), v.FieldErrors())
+		}
+
+		movie, err := app.models.Movies.Get(in.ID)
+		if err != nil {
+			if errors.Is(err, data.ErrNoRecordFound) {
+				return fail(http.StatusNotFound, err, nil)
+			}
+			return fail(http.StatusInternalServerError, errors.New("the server encountered a problem and could not process this operation"), nil)
+		}
+		if movie.Version != *in.Version {
+			return fail(http.StatusConflict, data.ErrEditConflict, nil)
+		}
+
+		var update updateMovieInput
+		if err := json.Unmarshal(in.Movie, &update); err != nil {
+			return fail(http.StatusBadRequest, err, nil)
+		}
+		update.apply(movie)
+		op.Movie = movie
+
+	default:
+		v.AddError("op", validator.CodeNotAllowed, "op must be one of create, update or delete")
+		return fail(http.StatusUnprocessableEntity, errors.New("invalid operation"), v.FieldErrors())
+	}
+
+	if data.ValidateMovie(v, op.Movie); !v.Valid() {
+		return fail(http.StatusUnprocessableEntity, errors.New("invalid movie"), v.FieldErrors())
+	}
+	return op, result
+}
+
+func batchErrorStatus(err error) (int, string, []validator.FieldError) {
+	switch {
+	case errors.Is(err, data.ErrNoRecordFound):
+		return http.StatusNotFound, err.Error(), nil
+	case errors.Is(err, data.ErrEditConflict):
+		return http.StatusConflict, err.Error(), nil
+	case errors.Is(err, data.ErrTrashedExternalID):
+		return http.StatusUnprocessableEntity, err.Error(), []validator.FieldError{{Field: "external_ids", Code: validator.CodeConflict, Message: "an external id belongs to a movie in the trash, restore or purge that movie first"}}
+	case errors.Is(err, data.ErrDuplicateExternalID):
+		return http.StatusUnprocessableEntity, err.Error(), []validator.FieldError{{Field: "external_ids", Code: validator.CodeNotUnique, Message: "an external id already points at another movie"}}
+	default:
+		return http.StatusInternalServerError, err.Error(), nil
+	}
+}
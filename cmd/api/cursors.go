@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor turns a cursor into an opaque token, signed so clients can't
+// craft their own.
+func (app *application) encodeCursor(cursor *data.Cursor) string {
+	js, _ := json.Marshal(cursor)
+
+	payload := base64.RawURLEncoding.EncodeToString(js)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(app.signCursor(payload))
+}
+
+func (app *application) decodeCursor(token string) (*data.Cursor, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, app.signCursor(payload)) {
+		return nil, errInvalidCursor
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var cursor data.Cursor
+	if err := json.Unmarshal(js, &cursor); err != nil {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func (app *application) signCursor(payload string) []byte {
+	mac := hmac.New(sha256.New, app.config.cursors.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// readCursor returns the cursor in the given query string parameter, or nil
+// when there is none.
+func (app *application) readCursor(qs url.Values, key string, v *validator.Validator) *data.Cursor {
+	token := qs.Get(key)
+	if token == "" {
+		return nil
+	}
+
+	cursor, err := app.decodeCursor(token)
+	if err != nil {
+		v.AddError(key, validator.CodeInvalid, "invalid or tampered cursor")
+		return nil
+	}
+	return cursor
+}
+
+// setPageLinks fills in the links to the next and previous pages of a keyset
+// pagination, keeping the other query string parameters of the request.
+func (app *application) setPageLinks(c echo.Context, metaData *data.MetaData) {
+	link := func(key string, cursor *data.Cursor) string {
+		qs := c.QueryParams()
+		query := make(url.Values, len(qs))
+		for k, values := range qs {
+			query[k] = values
+		}
+		query.Del("page")
+		query.Del("after")
+		query.Del("before")
+		query.Set(key, app.encodeCursor(cursor))
+
+		return c.Request().URL.Path + "?" + query.Encode()
+	}
+
+	if metaData.NextCursor != nil {
+		metaData.Next = link("after", metaData.NextCursor)
+	}
+	if metaData.PrevCursor != nil {
+		metaData.Prev = link("before", metaData.PrevCursor)
+	}
+}
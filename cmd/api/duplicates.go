@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) listDuplicateMoviesHandler(c echo.Context) error {
+	var input struct {
+		MinScore float64
+		data.Filter
+	}
+
+	v := validator.New()
+
+	input.MinScore = 0.7
+	if s := c.QueryParam("min_score"); s != "" {
+		score, err := strconv.ParseFloat(s, 64)
+		v.Check(err == nil, "min_score", validator.CodeInvalid, "min_score must be a number")
+		input.MinScore = score
+	}
+	input.Page = app.readInt(c.QueryParams(), "page", 1, v)
+	input.PageSize = app.readInt(c.QueryParams(), "page_size", 20, v)
+	input.Sort = "-score"
+	input.SortSafeList = []string{"-score"}
+
+	v.Check(input.MinScore >= 0 && input.MinScore <= 1, "min_score", validator.CodeOutOfRange, "min_score must be between 0 and 1")
+
+	if data.ValidateFilters(v, &input.Filter); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	candidates, metaData, err := app.models.Movies.FindDuplicates(input.MinScore, input.Filter)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Duplicate candidates returned successfully", "metadata": metaData, "duplicates": candidates})
+}
+
+func (app *application) mergeMoviesHandler(c echo.Context) error {
+	var input struct {
+		TargetID      int             `json:"target_id"`
+		SourceID      int             `json:"source_id"`
+		TargetVersion *int32          `json:"target_version"`
+		SourceVersion *int32          `json:"source_version"`
+		Rules         data.MergeRules `json:"rules"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	v := validator.New()
+
+	v.Check(input.TargetID >= 1, "target_id", validator.CodeRequired, "target_id must be provided and a positive integer")
+	v.Check(input.SourceID >= 1, "source_id", validator.CodeRequired, "source_id must be provided and a positive integer")
+	v.Check(input.TargetID != input.SourceID, "source_id", validator.CodeNotAllowed, "source_id must be different from target_id")
+
+	rules := data.DefaultMergeRules()
+	for field, rule := range input.Rules {
+		rules[field] = rule
+	}
+
+	if data.ValidateMergeRules(v, rules); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	target, err := app.readMergeSnapshot(input.TargetID, input.TargetVersion)
+	if err != nil {
+		return err
+	}
+	source, err := app.readMergeSnapshot(input.SourceID, input.SourceVersion)
+	if err != nil {
+		return err
+	}
+
+	merged := data.MergeMovies(target, source, rules)
+
+	if data.ValidateMovie(v, merged); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	err = app.models.Movies.Merge(merged, source, app.contextGetUser(c).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+		case errors.Is(err, data.ErrTrashedExternalID):
+			v.AddError("external_ids", validator.CodeConflict, "an external id belongs to a movie in the trash, restore or purge that movie first")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", validator.CodeNotUnique, "an external id already points at another movie")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		default:
+			return err
+		}
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/movies/%d", merged.ID))
+
+	return c.JSON(http.StatusOK, envelope{"message": "Movies merged successfully", "merged_id": source.ID, "movie": merged})
+}
+
+// readMergeSnapshot returns the full current state of a movie, taken from its
+// latest revision, checking it against the version the client expects.
+func (app *application) readMergeSnapshot(id int, version *int32) (*data.Movie, error) {
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Movie %d not found", id))
+		default:
+			return nil, err
+		}
+	}
+
+	if version != nil && *version != movie.Version {
+		return nil, echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+	}
+
+	revision, err := app.models.Revisions.Get(movie.ID, movie.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := revision.Snapshot
+	snapshot.ID = movie.ID
+	snapshot.Version = movie.Version
+	return snapshot, nil
+}
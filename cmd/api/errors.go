@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"movies/internal/validator"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// problem is an RFC 9457 problem details response.
+type problem struct {
+	Type     string                 `json:"type"`
+	Title    string                 `json:"title"`
+	Status   int                    `json:"status"`
+	Detail   string                 `json:"detail,omitempty"`
+	Instance string                 `json:"instance,omitempty"`
+	Errors   []validator.FieldError `json:"errors,omitempty"`
+}
+
+const internalErrorMessage = "the server encountered a problem and could not process your request"
+
+// problemTypes name the problem types after the status they are sent with,
+// the type URI being the configured base followed by the name.
+var problemTypes = map[int]string{
+	http.StatusBadRequest:            "bad-request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not-found",
+	http.StatusMethodNotAllowed:      "method-not-allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusPreconditionFailed:    "precondition-failed",
+	http.StatusRequestEntityTooLarge: "payload-too-large",
+	http.StatusUnsupportedMediaType:  "unsupported-media-type",
+	http.StatusUnprocessableEntity:   "unprocessable-entity",
+	http.StatusPreconditionRequired:  "precondition-required",
+	http.StatusTooManyRequests:       "too-many-requests",
+	http.StatusInternalServerError:   "internal-error",
+}
+
+// problemType returns the type URI of the problems sent with the status.
+// Statuses without a type of their own get about:blank, whose title is the
+// status text.
+func (app *application) problemType(status int) string {
+	name, ok := problemTypes[status]
+	if !ok {
+		return "about:blank"
+	}
+	return app.config.errors.typeBase + name
+}
+
+// errorHandler writes the errors returned by handlers as problem details, or
+// as {"error": message} when the legacy shape is enabled.
+func (app *application) errorHandler(err error, c echo.Context) {
+	status := http.StatusInternalServerError
+	var message interface{} = internalErrorMessage
+
+	if e, ok := err.(*echo.HTTPError); ok {
+		status = e.Code
+		message = e.Message
+	}
+
+	if c.Response().Committed {
+		return
+	}
+
+	if app.config.errors.legacy {
+		if v, ok := message.(*validator.Validator); ok {
+			message = v.Errors
+		}
+		c.JSON(status, envelope{"error": message})
+		return
+	}
+
+	p := problem{
+		Type:     app.problemType(status),
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+
+	switch m := message.(type) {
+	case *validator.Validator:
+		p.Type = app.config.errors.typeBase + "validation-failed"
+		p.Title = "Validation failed"
+		p.Detail = "one or more fields are invalid"
+		p.Errors = m.FieldErrors()
+	case string:
+		p.Detail = m
+	default:
+		p.Detail = fmt.Sprint(m)
+	}
+	// echo's own errors only repeat the status text
+	if strings.EqualFold(p.Detail, p.Title) {
+		p.Detail = ""
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/problem+json")
+	c.JSON(status, p)
+}
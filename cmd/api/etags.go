@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"movies/internal/data"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// movieETag returns the strong ETag of a movie representation. It starts with
+// the id and version of the movie, which is what If-Match is checked against,
+// and ends with a digest of the representation since localizations, images,
+// trailers and sparse fieldsets change it without a new version.
+func movieETag(movie *data.Movie, representation interface{}) (string, error) {
+	digest, err := digest(representation)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%d-%d-%s"`, movie.ID, movie.Version, digest), nil
+}
+
+// weakETag returns a weak ETag for a collection response.
+func weakETag(v interface{}) (string, error) {
+	digest, err := digest(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`W/"%s"`, digest), nil
+}
+
+func digest(v interface{}) (string, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	h := fnv.New64a()
+	h.Write(js)
+	return strconv.FormatUint(h.Sum64(), 36), nil
+}
+
+// parseMovieETag returns the id and version a movie ETag was made for.
+func parseMovieETag(etag string) (int, int32, bool) {
+	if strings.HasPrefix(etag, "W/") || len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, 0, false
+	}
+
+	parts := strings.Split(etag[1:len(etag)-1], "-")
+	if len(parts) != 3 {
+		return 0, 0, false
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	version, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return id, int32(version), true
+}
+
+func splitETags(header string) []string {
+	var etags []string
+	for _, etag := range strings.Split(header, ",") {
+		if etag = strings.TrimSpace(etag); etag != "" {
+			etags = append(etags, etag)
+		}
+	}
+	return etags
+}
+
+// notModified sets the ETag header and reports whether it matches the
+// If-None-Match header of the request.
+func (app *application) notModified(c echo.Context, etag string) bool {
+	c.Response().Header().Set("ETag", etag)
+
+	return app.etagMatches(c.Request().Header.Get("If-None-Match"), etag)
+}
+
+// checkIfMatch checks the If-Match header of the request against the current
+// version of the movie. It reports whether the header was sent, so callers
+// can answer a later edit conflict with 412 as well.
+func (app *application) checkIfMatch(c echo.Context, movie *data.Movie) (bool, error) {
+	header := c.Request().Header.Get("If-Match")
+	if header == "" {
+		if app.config.etags.requireIfMatch {
+			return false, echo.NewHTTPError(http.StatusPreconditionRequired, "this request must be made conditional with an If-Match header")
+		}
+		return false, nil
+	}
+
+	for _, candidate := range splitETags(header) {
+		if candidate == "*" {
+			return true, nil
+		}
+		id, version, ok := parseMovieETag(candidate)
+		if ok && id == movie.ID && version == movie.Version {
+			return true, nil
+		}
+	}
+	return true, echo.NewHTTPError(http.StatusPreconditionFailed, "the movie has been modified since it was fetched")
+}
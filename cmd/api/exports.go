@@ -0,0 +1,207 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"json":   echo.MIMEApplicationJSONCharsetUTF8,
+}
+
+func (app *application) exportMoviesHandler(c echo.Context) error {
+	var input struct {
+		Format string
+		data.MovieSearch
+		data.Filter
+	}
+
+	v := validator.New()
+
+	input.Format = app.readString(c.QueryParams(), "format", "ndjson")
+	input.MovieSearch = app.readMovieSearch(c, v)
+	input.Sort = app.readString(c.QueryParams(), "sort", "id")
+	input.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+
+	v.Check(validator.In(input.Format, "csv", "ndjson", "json"), "format", validator.CodeNotAllowed, "format must be one of csv, ndjson or json")
+	data.ValidateMovieSearch(v, input.MovieSearch)
+	v.Check(validator.In(input.Sort, input.SortSafeList...), "sort", validator.CodeNotAllowed, "invalid sort value")
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	res := c.Response()
+	res.Header().Add("Vary", "Accept-Encoding")
+
+	var w io.Writer = res
+	var gz *gzip.Writer
+	if acceptsGzip(c.Request().Header.Get("Accept-Encoding")) {
+		gz = gzip.NewWriter(res)
+		w = gz
+	}
+
+	encoder := newExportEncoder(input.Format, w)
+
+	// Headers go out with the first movie, so a failing query can still be
+	// reported with a proper error response.
+	started := false
+	start := func() error {
+		started = true
+		res.Header().Set(echo.HeaderContentType, exportContentTypes[input.Format])
+		res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies-%s.%s"`, time.Now().UTC().Format("20060102"), input.Format))
+		if gz != nil {
+			res.Header().Set(echo.HeaderContentEncoding, "gzip")
+		}
+		res.WriteHeader(http.StatusOK)
+		return encoder.begin()
+	}
+
+	count := 0
+	err := app.models.Movies.Export(c.Request().Context(), input.MovieSearch, input.Filter, func(movie *data.Movie) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		if err := encoder.encode(movie); err != nil {
+			return err
+		}
+
+		count++
+		if count%500 == 0 {
+			return flushExport(res, gz, encoder)
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = encoder.end()
+	}
+	if err == nil {
+		err = flushExport(res, gz, encoder)
+	}
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+
+	if err != nil && started {
+		// Once the status line is sent the error can't be reported to the
+		// client. The connection is aborted instead of ending the body, so the
+		// client can tell the export is truncated.
+		app.logger.Error("export failed", "request_id", res.Header().Get(echo.HeaderXRequestID), "movies", count, "err", err.Error())
+		panic(http.ErrAbortHandler)
+	}
+	return err
+}
+
+func flushExport(res *echo.Response, gz *gzip.Writer, encoder *exportEncoder) error {
+	if encoder.csv != nil {
+		encoder.csv.Flush()
+		if err := encoder.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if gz != nil {
+		if err := gz.Flush(); err != nil {
+			return err
+		}
+	}
+	res.Flush()
+	return nil
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+		return true
+	}
+	return false
+}
+
+// exportEncoder writes movies one at a time in one of the export formats.
+type exportEncoder struct {
+	format string
+	w      io.Writer
+	csv    *csv.Writer
+	json   *json.Encoder
+	count  int
+}
+
+func newExportEncoder(format string, w io.Writer) *exportEncoder {
+	encoder := &exportEncoder{format: format, w: w}
+	switch format {
+	case "csv":
+		encoder.csv = csv.NewWriter(w)
+	default:
+		encoder.json = json.NewEncoder(w)
+	}
+	return encoder
+}
+
+func (e *exportEncoder) begin() error {
+	switch e.format {
+	case "csv":
+		return e.csv.Write(append([]string{"id"}, data.ImportCSVColumns...))
+	case "json":
+		_, err := io.WriteString(e.w, `{"movies":[`)
+		return err
+	}
+	return nil
+}
+
+func (e *exportEncoder) encode(movie *data.Movie) error {
+	defer func() { e.count++ }()
+
+	switch e.format {
+	case "csv":
+		return e.csv.Write([]string{
+			strconv.Itoa(movie.ID),
+			movie.Title,
+			strconv.Itoa(int(movie.Year)),
+			strconv.Itoa(int(movie.Runtime)),
+			strings.Join(movie.Genres, "|"),
+			movie.ExternalIDs["imdb"],
+			movie.ExternalIDs["tmdb"],
+			movie.ExternalIDs["wikidata"],
+		})
+	case "json":
+		if e.count > 0 {
+			if _, err := io.WriteString(e.w, ","); err != nil {
+				return err
+			}
+		}
+	}
+	return e.json.Encode(movie)
+}
+
+func (e *exportEncoder) end() error {
+	if e.format == "json" {
+		_, err := io.WriteString(e.w, "]}\n")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+)
+
+// movieIncludes lists the related resources that can be embedded in a movie.
+var movieIncludes = []string{"localizations", "releases", "certifications", "images", "external_ids", "trailer", "credits", "ratings"}
+
+// movieDetails are the related resources embedded when the client doesn't
+// pick any.
+var movieDetails = []string{"releases", "certifications", "images", "external_ids"}
+
+// movieView is the shape of the movies a client asked for through the fields
+// and include query string parameters.
+type movieView struct {
+	fields  []string
+	include []string
+}
+
+// readMovieView reads the fields and include parameters. Without include the
+// given defaults are embedded, unless fields is set in which case nothing is.
+func (app *application) readMovieView(qs url.Values, v *validator.Validator, defaults ...string) movieView {
+	view := movieView{
+		fields:  app.readCSV(qs, "fields", nil),
+		include: app.readCSV(qs, "include", nil),
+	}
+
+	data.ValidateFields(v, "fields", view.fields, data.MovieFields)
+	data.ValidateFields(v, "include", view.include, movieIncludes)
+
+	if !qs.Has("include") && view.fields == nil {
+		view.include = defaults
+	}
+	return view
+}
+
+func (view movieView) includes(name string) bool {
+	for _, include := range view.include {
+		if include == name {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the movie as it should be written out, keeping only the
+// fields and embedded resources the client asked for.
+func (view movieView) render(movie *data.Movie) (interface{}, error) {
+	if view.fields == nil {
+		return movie, nil
+	}
+
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(js, &all); err != nil {
+		return nil, err
+	}
+
+	picked := map[string]json.RawMessage{"id": all["id"]}
+	for _, keys := range [][]string{view.fields, view.include} {
+		for _, key := range keys {
+			if value, ok := all[key]; ok {
+				picked[key] = value
+			}
+		}
+	}
+	return picked, nil
+}
+
+func (view movieView) renderAll(movies []*data.Movie) ([]interface{}, error) {
+	rendered := make([]interface{}, len(movies))
+	for i, movie := range movies {
+		r, err := view.render(movie)
+		if err != nil {
+			return nil, err
+		}
+		rendered[i] = r
+	}
+	return rendered, nil
+}
+
+// loadMovieDetails localizes the movies and embeds the related resources
+// included in the view, reading each of them for all the movies at once.
+func (app *application) loadMovieDetails(c echo.Context, view movieView, movies ...*data.Movie) error {
+	c.Response().Header().Add("Vary", "Accept-Language")
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	localizations, err := app.models.Localizations.GetForMovies(ids)
+	if err != nil {
+		return err
+	}
+
+	languages := app.readLanguages(c)
+	for _, movie := range movies {
+		movie.Localize(localizations[movie.ID], languages)
+		if view.includes("localizations") {
+			movie.Localizations = localizations[movie.ID]
+		}
+	}
+
+	if view.includes("releases") {
+		releases, err := app.models.Releases.GetForMovies(ids)
+		if err != nil {
+			return err
+		}
+		for _, movie := range movies {
+			movie.Releases = releases[movie.ID]
+		}
+	}
+
+	if view.includes("certifications") {
+		certifications, err := app.models.Releases.GetCertificationsForMovies(ids)
+		if err != nil {
+			return err
+		}
+		for _, movie := range movies {
+			movie.Certifications = certifications[movie.ID]
+		}
+	}
+
+	if view.includes("images") {
+		images, err := app.models.Images.GetForMovies(ids)
+		if err != nil {
+			return err
+		}
+		for _, movie := range movies {
+			movie.Images = images[movie.ID]
+		}
+	}
+
+	if view.includes("external_ids") {
+		externalIDs, err := app.models.ExternalIDs.GetForMovies(ids)
+		if err != nil {
+			return err
+		}
+		for _, movie := range movies {
+			movie.ExternalIDs = externalIDs[movie.ID]
+		}
+	}
+
+	if view.includes("credits") {
+		credits, err := app.models.Credits.GetForMovies(ids)
+		if err != nil {
+			return err
+		}
+		for _, movie := range movies {
+			movie.Credits = credits[movie.ID]
+		}
+	}
+
+	if view.includes("ratings") {
+		ratings, err := app.models.Ratings.GetSummariesForMovies(ids)
+		if err != nil {
+			return err
+		}
+		for _, movie := range movies {
+			movie.Ratings = ratings[movie.ID]
+		}
+	}
+
+	if view.includes("trailer") {
+		return app.loadMovieTrailers(movies...)
+	}
+	return nil
+}
@@ -1,71 +1,214 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"movies/internal/data"
+	"movies/internal/jsonpatch"
 	"movies/internal/validator"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/lib/pq"
 )
 
 func (app *application) getMoviesHandler(c echo.Context) error {
 	var input struct {
-		Title  string
-		Genres pq.StringArray
+		data.MovieSearch
 		data.Filter
 	}
 
 	v := validator.New()
 
-	input.Title = c.QueryParam("title")
-	input.Genres = app.readCSV(c.QueryParams(), "genres", []string{})
+	if c.QueryParams().Has("ids") {
+		ids := app.readIntCSV(c.QueryParams(), "ids", v)
+		if !v.Valid() {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		}
+		return app.batchGetMovies(c, ids)
+	}
+
+	input.MovieSearch = app.readMovieSearch(c, v)
 	input.Page = app.readInt(c.QueryParams(), "page", 1, v)
 	input.PageSize = app.readInt(c.QueryParams(), "page_size", 5, v)
 	input.Sort = app.readString(c.QueryParams(), "sort", "id")
-	input.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.SortSafeList = []string{"id", "title", "year", "runtime", "relevance", "popularity", "-id", "-title", "-year", "-runtime", "-relevance", "-popularity"}
+	input.After = app.readCursor(c.QueryParams(), "after", v)
+	input.Before = app.readCursor(c.QueryParams(), "before", v)
+	input.IncludeTotal = app.readBool(c.QueryParams(), "include_total", false, v)
+	view := app.readMovieView(c.QueryParams(), v, movieDetails...)
+	facets := app.readCSV(c.QueryParams(), "facets", nil)
+	fuzzy := app.readBool(c.QueryParams(), "fuzzy", false, v)
+
+	data.ValidateMovieSearch(v, input.MovieSearch)
+	data.ValidateFields(v, "facets", facets, data.MovieFacets)
+	v.Check(input.Title != "" || !strings.HasSuffix(input.Sort, "relevance"), "sort", validator.CodeNotAllowed, "sorting by relevance needs a title to search")
 
 	if data.ValidateFilters(v, &input.Filter); !v.Valid() {
-		return echo.NewHTTPError(http.StatusUnprocessableEntity, v.Errors)
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	movies, metaData, err := app.models.Movies.GetAll(input.MovieSearch, input.Filter, view.fields...)
+	if err != nil {
+		return err
+	}
+
+	// fall back to titles spelled alike when the full-text search finds nothing,
+	// later pages of the fallback first check that it still finds nothing
+	fuzzyMatched := false
+	if fuzzy && input.Title != "" && len(movies) == 0 && input.After == nil && input.Before == nil {
+		found := false
+		if input.Page > 1 {
+			first := input.Filter
+			first.Page, first.PageSize = 1, 1
+			matches, _, err := app.models.Movies.GetAll(input.MovieSearch, first, "id")
+			if err != nil {
+				return err
+			}
+			found = len(matches) > 0
+		}
+
+		if !found {
+			movies, metaData, err = app.models.Movies.GetAllFuzzy(input.MovieSearch, input.Filter, view.fields...)
+			if err != nil {
+				return err
+			}
+			fuzzyMatched = true
+		}
+	}
+	app.setPageLinks(c, &metaData)
+	app.recordImpressions(c, movies)
+
+	err = app.loadMovieDetails(c, view, movies...)
+	if err != nil {
+		return err
 	}
 
-	movies, metaData, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filter)
+	rendered, err := view.renderAll(movies)
 	if err != nil {
 		return err
 	}
-	return c.JSON(http.StatusOK, envelope{"message": "Movies returned succussfully", "metadata": metaData, "movies": movies})
+
+	body := envelope{"message": "Movies returned succussfully", "metadata": metaData, "movies": rendered}
+	if fuzzyMatched {
+		body["fuzzy"] = true
+	}
+
+	if facets != nil {
+		counts, err := app.models.Movies.Facets(input.MovieSearch, facets)
+		if err != nil {
+			return err
+		}
+		body["facets"] = counts
+	}
+
+	etag, err := weakETag(body)
+	if err != nil {
+		return err
+	}
+	if app.notModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.JSON(http.StatusOK, body)
 }
-func (app *application) createMovieHandler(c echo.Context) error {
-	var input struct {
-		Title   string   `json:"title"`
-		Year    int32    `json:"year"`
-		Runtime int32    `json:"runtime"`
-		Genres  []string `json:"genres"`
+
+// createMovieInput is the body accepted to create a movie.
+type createMovieInput struct {
+	Title          string                `json:"title"`
+	Year           int32                 `json:"year"`
+	Runtime        int32                 `json:"runtime"`
+	Genres         []string              `json:"genres"`
+	Localizations  []*data.Localization  `json:"localizations"`
+	Releases       []*data.Release       `json:"releases"`
+	Certifications []*data.Certification `json:"certifications"`
+	ExternalIDs    map[string]string     `json:"external_ids"`
+}
+
+func (input createMovieInput) movie() *data.Movie {
+	return &data.Movie{
+		Title:          input.Title,
+		Year:           input.Year,
+		Runtime:        input.Runtime,
+		Genres:         input.Genres,
+		Localizations:  input.Localizations,
+		Releases:       input.Releases,
+		Certifications: input.Certifications,
+		ExternalIDs:    input.ExternalIDs,
+	}
+}
+
+// updateMovieInput is the body accepted to update a movie, fields left out are
+// kept as they are.
+type updateMovieInput struct {
+	Title          *string               `json:"title,omitempty"`
+	Year           *int32                `json:"year,omitempty"`
+	Runtime        *int32                `json:"runtime,omitempty"`
+	Genres         []string              `json:"genres,omitempty"`
+	Localizations  []*data.Localization  `json:"localizations,omitempty"`
+	Releases       []*data.Release       `json:"releases,omitempty"`
+	Certifications []*data.Certification `json:"certifications,omitempty"`
+	ExternalIDs    map[string]string     `json:"external_ids,omitempty"`
+}
+
+func (input updateMovieInput) apply(movie *data.Movie) {
+	if input.Title != nil {
+		movie.Title = *input.Title
+	}
+	if input.Year != nil {
+		movie.Year = *input.Year
+	}
+	if input.Runtime != nil {
+		movie.Runtime = *input.Runtime
+	}
+	if input.Genres != nil {
+		movie.Genres = input.Genres
+	}
+	if input.Localizations != nil {
+		movie.Localizations = input.Localizations
+	}
+	if input.Releases != nil {
+		movie.Releases = input.Releases
+	}
+	if input.Certifications != nil {
+		movie.Certifications = input.Certifications
 	}
+	if input.ExternalIDs != nil {
+		movie.ExternalIDs = input.ExternalIDs
+	}
+}
+
+func (app *application) createMovieHandler(c echo.Context) error {
+	var input createMovieInput
 
 	if err := c.Bind(&input); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
-	}
+	movie := input.movie()
 
 	v := validator.New()
 
 	if data.ValidateMovie(v, movie); !v.Valid() {
-		return echo.NewHTTPError(http.StatusUnprocessableEntity, v.Errors)
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
 	}
 
-	err := app.models.Movies.Insert(movie)
+	err := app.models.Movies.Insert(movie, app.contextGetUser(c).ID)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, data.ErrTrashedExternalID):
+			v.AddError("external_ids", validator.CodeConflict, "an external id belongs to a movie in the trash, restore or purge that movie first")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", validator.CodeNotUnique, "an external id already points at another movie")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		default:
+			return err
+		}
 	}
 
 	c.Response().Header().Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
@@ -76,76 +219,224 @@ func (app *application) createMovieHandler(c echo.Context) error {
 	})
 }
 func (app *application) showMovieHandler(c echo.Context) error {
-	id, err := app.readIDParam(c)
+	id, err := app.readMovieIDParam(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	v := validator.New()
+
+	view := app.readMovieView(c.QueryParams(), v, append(movieDetails, "trailer")...)
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	movie, err := app.models.Movies.Get(id, view.fields...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrNoRecordFound):
+			if to, err := app.models.Movies.GetRedirect(id); err == nil {
+				location := fmt.Sprintf("/v1/movies/%d", to)
+				if query := c.QueryString(); query != "" {
+					location += "?" + query
+				}
+				return c.Redirect(http.StatusMovedPermanently, location)
+			}
 			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
 		default:
 			return err
 		}
 	}
 
-	return c.JSON(http.StatusOK, envelope{"message": "Movie returned succussfully", "movie": movie})
+	app.recordView(c, movie.ID)
+
+	err = app.loadMovieDetails(c, view, movie)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := view.render(movie)
+	if err != nil {
+		return err
+	}
+
+	etag, err := movieETag(movie, rendered)
+	if err != nil {
+		return err
+	}
+	if app.notModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Movie returned succussfully", "movie": rendered})
 
 }
 
-func (app *application) updateMovieHandler(c echo.Context) error {
-	id, err := app.readIDParam(c)
+// loadMovieTrailers embeds the official trailer of every movie, in the language
+// the movie was localized to when there is one.
+func (app *application) loadMovieTrailers(movies ...*data.Movie) error {
+	byLanguage := make(map[string][]int)
+	for _, movie := range movies {
+		byLanguage[movie.Language] = append(byLanguage[movie.Language], movie.ID)
+	}
+
+	trailers := make(map[int]*data.Video, len(movies))
+	for language, ids := range byLanguage {
+		found, err := app.models.Videos.GetOfficialTrailers(ids, language)
+		if err != nil {
+			return err
+		}
+		for id, trailer := range found {
+			trailers[id] = trailer
+		}
+	}
+
+	for _, movie := range movies {
+		movie.Trailer = trailers[movie.ID]
+	}
+	return nil
+}
+
+func (app *application) upcomingReleasesHandler(c echo.Context) error {
+	var input struct {
+		Country string
+		data.Filter
+	}
+
+	v := validator.New()
+
+	input.Country = strings.ToUpper(c.QueryParam("country"))
+	input.Page = app.readInt(c.QueryParams(), "page", 1, v)
+	input.PageSize = app.readInt(c.QueryParams(), "page_size", 20, v)
+	input.Sort = app.readString(c.QueryParams(), "sort", "release_date")
+	input.SortSafeList = []string{"release_date", "-release_date"}
+
+	v.Check(input.Country == "" || validator.Matches(input.Country, validator.CountryRX), "country", validator.CodeInvalid, "country must be an ISO 3166-1 alpha-2 code such as US")
+
+	if data.ValidateFilters(v, &input.Filter); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	releases, metaData, err := app.models.Releases.GetUpcoming(input.Country, input.Filter)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return err
 	}
+	return c.JSON(http.StatusOK, envelope{"message": "Upcoming releases returned successfully", "metadata": metaData, "releases": releases})
+}
 
-	movie, err := app.models.Movies.Get(id)
+func (app *application) lookupMovieHandler(c echo.Context) error {
+	v := validator.New()
+
+	var provider, value string
+	for name := range validator.ExternalIDProviders {
+		if param := c.QueryParam(name); param != "" {
+			v.Check(provider == "", "provider", validator.CodeNotAllowed, "only one of imdb, tmdb or wikidata can be provided")
+			provider, value = name, param
+		}
+	}
+
+	v.Check(provider != "", "provider", validator.CodeRequired, "one of imdb, tmdb or wikidata must be provided")
+	v.Check(provider == "" || validator.ExternalID(provider, value), provider, validator.CodeInvalid, provider+" id is not in a valid format")
+
+	view := app.readMovieView(c.QueryParams(), v, movieDetails...)
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	id, err := app.models.ExternalIDs.GetMovieID(provider, value)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrNoRecordFound):
-			return echo.NewHTTPError(http.StatusNotFound, data.ErrNoRecordFound.Error())
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
 		default:
 			return err
 		}
 	}
 
-	var input struct {
-		Title   *string  `json:"title,omitempty"`
-		Year    *int32   `json:"year,omitempty"`
-		Runtime *int32   `json:"runtime,omitempty"`
-		Genres  []string `json:"genres,omitempty"`
+	movie, err := app.models.Movies.Get(id, view.fields...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
 	}
 
-	if err := c.Bind(&input); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	err = app.loadMovieDetails(c, view, movie)
+	if err != nil {
+		return err
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
+	c.Response().Header().Set("Content-Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+
+	rendered, err := view.render(movie)
+	if err != nil {
+		return err
 	}
-	if input.Year != nil {
-		movie.Year = *input.Year
+
+	etag, err := movieETag(movie, rendered)
+	if err != nil {
+		return err
 	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+	if app.notModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+
+	return c.JSON(http.StatusOK, envelope{"message": "Movie returned succussfully", "movie": rendered})
+}
+
+func (app *application) updateMovieHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, data.ErrNoRecordFound.Error())
+		default:
+			return err
+		}
+	}
+
+	conditional, err := app.checkIfMatch(c, movie)
+	if err != nil {
+		return err
+	}
+
+	movie, err = app.patchMovie(c, movie)
+	if err != nil {
+		return err
 	}
 
 	v := validator.New()
 
 	if data.ValidateMovie(v, movie); !v.Valid() {
-		return echo.NewHTTPError(http.StatusUnprocessableEntity, v.Errors)
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(c).ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && conditional:
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "the movie has been modified since it was fetched")
 		case errors.Is(err, data.ErrEditConflict):
 			return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+		case errors.Is(err, data.ErrTrashedExternalID):
+			v.AddError("external_ids", validator.CodeConflict, "an external id belongs to a movie in the trash, restore or purge that movie first")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", validator.CodeNotUnique, "an external id already points at another movie")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
 		default:
 			return err
 		}
@@ -153,20 +444,140 @@ func (app *application) updateMovieHandler(c echo.Context) error {
 
 	c.Response().Header().Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
 
+	etag, err := movieETag(movie, movie)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("ETag", etag)
+
 	return c.JSON(http.StatusCreated, envelope{"message": "Movie Updated succussfully", "movie": movie})
 }
 
+const maxPatchBytes = 1 << 20
+
+// patchMovie applies the request body to the movie according to its content
+// type. Plain JSON only replaces the fields it sets, merge patches and JSON
+// patches can also clear fields and change single items of a list.
+func (app *application) patchMovie(c echo.Context, movie *data.Movie) (*data.Movie, error) {
+	mediaType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be application/json, application/merge-patch+json or application/json-patch+json")
+	}
+
+	if mediaType == echo.MIMEApplicationJSON {
+		var input updateMovieInput
+
+		if err := c.Bind(&input); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		input.apply(movie)
+		return movie, nil
+	}
+
+	var apply func(*data.Movie, []byte) (*data.Movie, error)
+
+	switch mediaType {
+	case "application/merge-patch+json":
+		apply = data.ApplyMergePatch
+	case "application/json-patch+json":
+		apply = data.ApplyJSONPatch
+	default:
+		return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be application/json, application/merge-patch+json or application/json-patch+json")
+	}
+
+	// patches apply to the whole movie, collections included
+	err = app.loadMovieCollections(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPatchBytes+1))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if len(patch) > maxPatchBytes {
+		return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("patch must not be larger than %d bytes", maxPatchBytes))
+	}
+
+	patched, err := apply(movie, patch)
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var opErr *jsonpatch.OperationError
+
+		switch {
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			return nil, echo.NewHTTPError(http.StatusConflict, err.Error())
+		case errors.As(err, &opErr), errors.As(err, &typeErr):
+			return nil, echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		default:
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+	return patched, nil
+}
+
+// loadMovieCollections reads the localizations, releases, certifications and
+// external ids of the movie.
+func (app *application) loadMovieCollections(movie *data.Movie) error {
+	ids := []int{movie.ID}
+
+	localizations, err := app.models.Localizations.GetForMovies(ids)
+	if err != nil {
+		return err
+	}
+	releases, err := app.models.Releases.GetForMovies(ids)
+	if err != nil {
+		return err
+	}
+	certifications, err := app.models.Releases.GetCertificationsForMovies(ids)
+	if err != nil {
+		return err
+	}
+	externalIDs, err := app.models.ExternalIDs.GetForMovies(ids)
+	if err != nil {
+		return err
+	}
+
+	movie.Localizations = localizations[movie.ID]
+	movie.Releases = releases[movie.ID]
+	movie.Certifications = certifications[movie.ID]
+	movie.ExternalIDs = externalIDs[movie.ID]
+	return nil
+}
+
 func (app *application) deleteMovieHandler(c echo.Context) error {
 	id, err := app.readIDParam(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
 
-	err = app.models.Movies.Delete(id)
+	var version *int32
+
+	if c.Request().Header.Get("If-Match") != "" || app.config.etags.requireIfMatch {
+		movie, err := app.models.Movies.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				return echo.NewHTTPError(http.StatusNotFound, data.ErrNoRecordFound.Error())
+			default:
+				return err
+			}
+		}
+
+		if _, err := app.checkIfMatch(c, movie); err != nil {
+			return err
+		}
+		version = &movie.Version
+	}
+
+	err = app.models.Movies.Delete(id, version, app.contextGetUser(c).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrNoRecordFound):
 			return echo.NewHTTPError(http.StatusNotFound, data.ErrNoRecordFound.Error())
+		case errors.Is(err, data.ErrEditConflict):
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "the movie has been modified since it was fetched")
 		default:
 			return err
 		}
@@ -200,15 +611,15 @@ func (app *application) registerUserHandler(c echo.Context) error {
 	v := validator.New()
 
 	if data.ValidateUser(v, user); !v.Valid() {
-		return echo.NewHTTPError(http.StatusUnprocessableEntity, v.Errors)
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
 	}
 
 	err = app.models.Users.Insert(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "a user with this email address already exists")
-			return echo.NewHTTPError(http.StatusUnprocessableEntity, v.Errors)
+			v.AddError("email", validator.CodeNotUnique, "a user with this email address already exists")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
 		default:
 			return err
 		}
@@ -252,15 +663,15 @@ func (app *application) activateUserHandler(c echo.Context) error {
 	v := validator.New()
 
 	if data.ValidateTokenPlainText(v, input.Token); !v.Valid() {
-		return echo.NewHTTPError(http.StatusUnprocessableEntity, v.Errors)
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
 	}
 
 	user, err := app.models.Users.GetByToken(data.ScopeActivation, input.Token)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrNoRecordFound):
-			v.AddError("token", "invalid or expired activation token")
-			return echo.NewHTTPError(http.StatusUnprocessableEntity, v.Errors)
+			v.AddError("token", validator.CodeInvalid, "invalid or expired activation token")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
 		default:
 			return err
 		}
@@ -303,7 +714,7 @@ func (app *application) authenticationTokenHandler(c echo.Context) error {
 	data.ValidPlainText(v, &input.Password)
 
 	if !v.Valid() {
-		return echo.NewHTTPError(http.StatusUnprocessableEntity, v.Errors)
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
 	}
 
 	user, err := app.models.Users.GetByEmail(input.Email)
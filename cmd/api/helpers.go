@@ -2,10 +2,13 @@ package main
 
 import (
 	"errors"
+	"movies/internal/data"
 	"movies/internal/validator"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -18,6 +21,40 @@ func (app *application) readIDParam(c echo.Context) (int, error) {
 	return id, nil
 }
 
+func (app *application) readIntParam(c echo.Context, name string) (int, error) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid " + strings.ReplaceAll(name, "_", " ") + " parameter")
+	}
+	return id, nil
+}
+
+// readMovieIDParam accepts either a numeric movie id or an external id in the
+// provider:value form, e.g. imdb:tt0111161.
+func (app *application) readMovieIDParam(c echo.Context) (int, error) {
+	provider, value, found := strings.Cut(c.Param("id"), ":")
+	if !found {
+		id, err := app.readIDParam(c)
+		if err != nil {
+			return 0, data.ErrNoRecordFound
+		}
+		return id, nil
+	}
+
+	if !validator.ExternalID(provider, value) {
+		return 0, data.ErrNoRecordFound
+	}
+	return app.models.ExternalIDs.GetMovieID(provider, value)
+}
+
+func (app *application) contextGetUser(c echo.Context) *data.User {
+	user, ok := c.Get("user").(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
 type envelope map[string]interface{}
 
 func (app *application) readString(qs url.Values, key, defaultValue string) string {
@@ -36,12 +73,40 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	i, err := strconv.Atoi(n)
 	if err != nil {
-		v.AddError(key, "must be an integer value")
+		v.AddError(key, validator.CodeInvalid, "must be an integer value")
 		return defaultValue
 	}
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, validator.CodeInvalid, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+func (app *application) readDate(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+	date, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		v.AddError(key, validator.CodeInvalid, "must be a date in the YYYY-MM-DD format")
+		return nil
+	}
+	return &date
+}
+
 func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
 	csv := qs.Get(key)
 
@@ -51,6 +116,101 @@ func (app *application) readCSV(qs url.Values, key string, defaultValue []string
 	return strings.Split(csv, ",")
 }
 
+func (app *application) readIntCSV(qs url.Values, key string, v *validator.Validator) []int {
+	parts := app.readCSV(qs, key, []string{})
+
+	ints := make([]int, 0, len(parts))
+	for _, part := range parts {
+		i, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			v.AddError(key, validator.CodeInvalid, "must be a comma separated list of integers")
+			return nil
+		}
+		ints = append(ints, i)
+	}
+	return ints
+}
+
+// readMovieSearch reads the search parameters shared by the movie listing and
+// the export. The title is searched in the language the client prefers.
+func (app *application) readMovieSearch(c echo.Context, v *validator.Validator) data.MovieSearch {
+	qs := c.QueryParams()
+
+	search := data.MovieSearch{
+		Title:          qs.Get("title"),
+		Genres:         app.readCSV(qs, "genres", []string{}),
+		ReleasedBefore: app.readDate(qs, "released_before", v),
+		ReleasedAfter:  app.readDate(qs, "released_after", v),
+		Country:        strings.ToUpper(qs.Get("country")),
+		YearMin:        app.readInt(qs, "year_min", 0, v),
+		YearMax:        app.readInt(qs, "year_max", 0, v),
+		RuntimeMin:     app.readInt(qs, "runtime_min", 0, v),
+		RuntimeMax:     app.readInt(qs, "runtime_max", 0, v),
+	}
+	if languages := app.readLanguages(c); len(languages) > 0 {
+		search.Language = languages[0]
+	}
+	return search
+}
+
+// readLanguages returns the languages requested by the client in order of preference,
+// the lang query parameter taking precedence over the Accept-Language header.
+func (app *application) readLanguages(c echo.Context) []string {
+	if lang := c.QueryParam("lang"); lang != "" {
+		return strings.Split(lang, ",")
+	}
+
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var languages []weighted
+	for _, part := range strings.Split(c.Request().Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		languages = append(languages, weighted{tag: tag, q: q})
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].q > languages[j].q
+	})
+
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+// etagMatches reports whether the given If-None-Match or If-Match header lists the
+// entity tag, using the weak comparison for If-None-Match semantics.
+func (app *application) etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	go func() {
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"movies/internal/data"
+	"movies/internal/imaging"
+	"movies/internal/storage"
+	"movies/internal/validator"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) listMovieImagesHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
+	}
+
+	images, err := app.models.Images.GetForMovies([]int{id})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Images returned successfully", "images": images[id]})
+}
+
+func (app *application) uploadMovieImageHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
+	}
+
+	// leave some room for the multipart envelope around the file itself
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, app.config.images.maxBytes+1<<20)
+
+	v := validator.New()
+
+	header, err := c.FormFile("image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("image must not be larger than %d bytes", app.config.images.maxBytes))
+		case errors.Is(err, http.ErrMissingFile):
+			v.AddError("image", validator.CodeRequired, "image must be provided")
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	kind := c.FormValue("kind")
+	if kind == "" {
+		kind = data.ImagePoster
+	}
+	v.Check(validator.In(kind, data.ImageKinds...), "kind", validator.CodeNotAllowed, "kind must be either poster or still")
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	if header.Size > app.config.images.maxBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("image must not be larger than %d bytes", app.config.images.maxBytes))
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	upload, err := io.ReadAll(io.LimitReader(file, app.config.images.maxBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(upload)) > app.config.images.maxBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("image must not be larger than %d bytes", app.config.images.maxBytes))
+	}
+
+	contentType := http.DetectContentType(upload)
+	if !validator.In(contentType, "image/jpeg", "image/png") {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "image must be a JPEG or PNG file")
+	}
+
+	result, err := imaging.Process(upload)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedFormat):
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType, "image must be a JPEG or PNG file")
+		case errors.Is(err, imaging.ErrTooLarge):
+			v.AddError("image", validator.CodeOutOfRange, "image dimensions are too large")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		default:
+			return err
+		}
+	}
+
+	checksum := sha256.Sum256(upload)
+	image := &data.Image{
+		MovieID:     id,
+		Kind:        kind,
+		ContentType: result.ContentType(),
+		Width:       result.Width,
+		Height:      result.Height,
+		Checksum:    hex.EncodeToString(checksum[:]),
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 30*time.Second)
+	defer cancel()
+
+	for _, variant := range result.Variants {
+		err = app.storage.Put(ctx, image.Key(variant.Name), variant.Data, image.ContentType)
+		if err != nil {
+			app.discardImage(image)
+			return err
+		}
+		image.Variants = append(image.Variants, variant.Name)
+	}
+
+	err = app.models.Images.Insert(image)
+	if err != nil {
+		app.discardImage(image)
+		return err
+	}
+
+	c.Response().Header().Set("Location", image.URLs["original"])
+
+	return c.JSON(http.StatusCreated, envelope{"message": "Image uploaded successfully", "image": image})
+}
+
+func (app *application) deleteMovieImageHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	imageID, err := app.readIntParam(c, "image_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	image, err := app.models.Images.Get(imageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Image not found")
+		default:
+			return err
+		}
+	}
+	if image.MovieID != id {
+		return echo.NewHTTPError(http.StatusNotFound, "Image not found")
+	}
+
+	shared, err := app.models.Images.Delete(image)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Image not found")
+		default:
+			return err
+		}
+	}
+
+	if !shared {
+		app.background(func() {
+			app.deleteImageFiles(image)
+		})
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Image deleted successfully"})
+}
+
+func (app *application) serveImageHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	image, err := app.models.Images.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Image not found")
+		default:
+			return err
+		}
+	}
+
+	variant := c.Param("variant")
+	if !validator.In(variant, image.Variants...) {
+		return echo.NewHTTPError(http.StatusNotFound, "Image not found")
+	}
+
+	etag := image.ETag(variant)
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	header.Set("Last-Modified", image.CreatedAt.UTC().Format(http.TimeFormat))
+	header.Set("Content-Type", image.ContentType)
+
+	if app.etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	object, err := app.storage.Get(c.Request().Context(), image.Key(variant))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Image not found")
+		default:
+			return err
+		}
+	}
+	defer object.Close()
+
+	// files can be served with ranges, other objects are streamed as they come
+	if content, ok := object.(io.ReadSeeker); ok {
+		http.ServeContent(c.Response(), c.Request(), "", image.CreatedAt, content)
+		return nil
+	}
+	return c.Stream(http.StatusOK, image.ContentType, object)
+}
+
+// deleteImageFiles deletes the stored variants of the image.
+func (app *application) deleteImageFiles(image *data.Image) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, variant := range image.Variants {
+		if err := app.storage.Delete(ctx, image.Key(variant)); err != nil {
+			app.logger.Error(err.Error())
+		}
+	}
+}
+
+// discardImage deletes the variants stored for an image that couldn't be
+// saved, unless another image with the same content references them.
+func (app *application) discardImage(image *data.Image) {
+	app.background(func() {
+		shared, err := app.models.Images.Shared(image.Checksum)
+		if err != nil {
+			app.logger.Error(err.Error())
+			return
+		}
+		if !shared {
+			app.deleteImageFiles(image)
+		}
+	})
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) importMoviesHandler(c echo.Context) error {
+	// leave some room for the multipart envelope around the file itself
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, app.config.imports.maxBytes+1<<20)
+
+	v := validator.New()
+
+	dryRun := app.readBool(c.QueryParams(), "dry_run", false, v)
+	upsert := app.readBool(c.QueryParams(), "upsert", false, v)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("file must not be larger than %d bytes", app.config.imports.maxBytes))
+		case errors.Is(err, http.ErrMissingFile):
+			v.AddError("file", validator.CodeRequired, "file must be provided")
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	if header.Size > app.config.imports.maxBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("file must not be larger than %d bytes", app.config.imports.maxBytes))
+	}
+
+	format := importFormat(c.QueryParam("format"), header)
+	if format == "" {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "file must be a CSV or NDJSON file")
+	}
+
+	job := &data.ImportJob{
+		UserID: app.contextGetUser(c).ID,
+		Format: format,
+		DryRun: dryRun,
+		Upsert: upsert,
+		Status: data.ImportPending,
+	}
+	opts := data.ImportOptions{DryRun: dryRun, Upsert: upsert, EditorID: job.UserID}
+
+	if header.Size <= app.config.imports.syncMaxBytes {
+		file, err := header.Open()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		reader, err := data.NewImportReader(format, file)
+		if err != nil {
+			v.AddError("file", validator.CodeInvalid, err.Error())
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		}
+
+		err = app.models.ImportJobs.Insert(job)
+		if err != nil {
+			return err
+		}
+
+		app.runImport(job, reader, opts)
+
+		return c.JSON(http.StatusOK, envelope{"message": "Import finished", "import": job})
+	}
+
+	// The upload is gone once the request completes, larger files are kept in
+	// a temporary file for the background job to read.
+	file, err := spoolUpload(header)
+	if err != nil {
+		return err
+	}
+
+	reader, err := data.NewImportReader(format, file)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		v.AddError("file", validator.CodeInvalid, err.Error())
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	err = app.models.ImportJobs.Insert(job)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	accepted := *job
+
+	app.runJob(func() {
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		app.runImport(job, reader, opts)
+	})
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/movies/import/%d", job.ID))
+
+	return c.JSON(http.StatusAccepted, envelope{"message": "Import started", "import": accepted})
+}
+
+func (app *application) showImportHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	job, err := app.models.ImportJobs.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Import not found")
+		default:
+			return err
+		}
+	}
+
+	if job.UserID != app.contextGetUser(c).ID {
+		return echo.NewHTTPError(http.StatusNotFound, "Import not found")
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Import returned successfully", "import": job})
+}
+
+// runImport validates the rows of an import and writes them in batches, saving
+// the progress of the job after every batch.
+func (app *application) runImport(job *data.ImportJob, reader data.ImportReader, opts data.ImportOptions) {
+	job.Status = data.ImportRunning
+	job.Errors = []data.ImportRowError{}
+
+	finish := func(err error) {
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Status = data.ImportCompleted
+		if err != nil {
+			app.logger.Error("import failed", "import", job.ID, "err", err.Error())
+			job.Status = data.ImportFailed
+			job.Error = err.Error()
+		}
+		if err := app.models.ImportJobs.Update(job); err != nil {
+			app.logger.Error(err.Error())
+		}
+	}
+
+	// a job that panics must not be left running, the panic carries on to
+	// whoever recovers it
+	defer func() {
+		if err := recover(); err != nil {
+			finish(fmt.Errorf("%v", err))
+			panic(err)
+		}
+	}()
+
+	session, err := app.models.Movies.NewImportSession(opts)
+	if err != nil {
+		finish(err)
+		return
+	}
+	defer session.Close()
+
+	batch := make([]*data.ImportRow, 0, data.ImportBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := session.Batch(batch)
+		if err != nil {
+			return err
+		}
+		job.Record(batch)
+		batch = batch[:0]
+		return app.models.ImportJobs.Update(job)
+	}
+
+	for {
+		row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			finish(err)
+			return
+		}
+
+		if row.Errors == nil {
+			v := validator.New()
+			if data.ValidateMovie(v, row.Movie); !v.Valid() {
+				row.Errors = v
+			}
+		}
+
+		batch = append(batch, row)
+		if len(batch) == data.ImportBatchSize {
+			if err := flush(); err != nil {
+				finish(err)
+				return
+			}
+		}
+	}
+
+	finish(flush())
+}
+
+func importFormat(format string, header *multipart.FileHeader) string {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(header.Filename)) {
+		case ".csv":
+			format = data.ImportFormatCSV
+		case ".ndjson", ".jsonl":
+			format = data.ImportFormatNDJSON
+		}
+	}
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = data.ImportFormatCSV
+		case "application/x-ndjson", "application/jsonl":
+			format = data.ImportFormatNDJSON
+		}
+	}
+	if format != data.ImportFormatCSV && format != data.ImportFormatNDJSON {
+		return ""
+	}
+	return format
+}
+
+func spoolUpload(header *multipart.FileHeader) (*os.File, error) {
+	src, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	file, err := os.CreateTemp("", "movies-import-*")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(file, src)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
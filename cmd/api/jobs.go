@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// purgeTrash permanently removes movies that have been in the trash for longer
+// than the configured retention, until ctx is cancelled.
+func (app *application) purgeTrash(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, images, err := app.models.Movies.PurgeExpired(app.config.trash.retention)
+			if err != nil {
+				app.logger.Error("purging trash", "err", err.Error())
+				continue
+			}
+			for _, image := range images {
+				app.deleteImageFiles(image)
+			}
+			if purged > 0 {
+				app.logger.Info("purged trash", "movies", purged)
+			}
+		}
+	}
+}
+
+// refreshSimilarMovies recomputes the similar movies of every movie once per
+// refresh interval, a batch at a time, until ctx is cancelled.
+func (app *application) refreshSimilarMovies(ctx context.Context) {
+	ticker := time.NewTicker(app.config.similar.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		refreshed := 0
+		for ctx.Err() == nil {
+			n, err := app.models.Similarities.Refresh(app.config.similar.batchSize, app.config.similar.refreshInterval)
+			if err != nil {
+				app.logger.Error("refreshing similar movies", "err", err.Error())
+			}
+			// a failed batch is skipped rather than retried, the loop stops
+			// once no stale movie is left
+			if n == 0 {
+				break
+			}
+			if err == nil {
+				refreshed += n
+			}
+		}
+		if refreshed > 0 {
+			app.logger.Info("refreshed similar movies", "movies", refreshed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshStats refreshes the materialized views behind the statistics once per
+// refresh interval, until ctx is cancelled.
+func (app *application) refreshStats(ctx context.Context) {
+	ticker := time.NewTicker(app.config.stats.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.models.Stats.Refresh(); err != nil {
+				app.logger.Error("refreshing stats", "err", err.Error())
+			}
+		}
+	}
+}
+
+// saveViews writes the views counted in memory to the database once per flush
+// interval, until ctx is cancelled.
+func (app *application) saveViews(ctx context.Context) {
+	ticker := time.NewTicker(app.config.views.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.flushViews(); err != nil {
+				app.logger.Error("saving views", "err", err.Error())
+			}
+		}
+	}
+}
+
+// refreshPopularity recomputes the popularity of the movies from their views
+// once per popularity interval, until ctx is cancelled.
+func (app *application) refreshPopularity(ctx context.Context) {
+	ticker := time.NewTicker(app.config.views.popularityInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.models.Views.RefreshPopularity(); err != nil {
+				app.logger.Error("refreshing popularity", "err", err.Error())
+			}
+		}
+	}
+}
+
+// runJob runs long tasks such as imports outside of the request that started
+// them. Unlike background, the request doesn't wait for them to complete.
+func (app *application) runJob(fn func()) {
+	app.jobs.Add(1)
+	go func() {
+		defer app.jobs.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprint(err))
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"flag"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"log/slog"
 	"movies/internal/data"
 	"movies/internal/mailer"
+	"movies/internal/storage"
 	"net/http"
 	"os"
 	"os/signal"
@@ -45,20 +47,91 @@ type smtp struct {
 	sender   string
 }
 
+type storageConfig struct {
+	driver      string
+	path        string
+	s3Endpoint  string
+	s3Region    string
+	s3Bucket    string
+	s3AccessKey string
+	s3SecretKey string
+}
+
+type imagesConfig struct {
+	maxBytes int64
+}
+
+type trashConfig struct {
+	retention     time.Duration
+	purgeInterval time.Duration
+}
+
+type importsConfig struct {
+	maxBytes     int64
+	syncMaxBytes int64
+}
+
+type cursorsConfig struct {
+	secret []byte
+}
+
+type autocompleteConfig struct {
+	cacheTTL time.Duration
+}
+
+type similarConfig struct {
+	refreshInterval time.Duration
+	batchSize       int
+}
+
+type statsConfig struct {
+	refreshInterval time.Duration
+}
+
+type viewsConfig struct {
+	flushInterval      time.Duration
+	dedupWindow        time.Duration
+	popularityInterval time.Duration
+}
+
+type errorsConfig struct {
+	typeBase string
+	legacy   bool
+}
+
+type etagsConfig struct {
+	requireIfMatch bool
+}
+
 type config struct {
-	port    int
-	env     string
-	db      dbConfig
-	limiter rateLimitConfig
-	smtp    smtp
+	port         int
+	env          string
+	db           dbConfig
+	limiter      rateLimitConfig
+	smtp         smtp
+	storage      storageConfig
+	images       imagesConfig
+	trash        trashConfig
+	imports      importsConfig
+	etags        etagsConfig
+	cursors      cursorsConfig
+	autocomplete autocompleteConfig
+	similar      similarConfig
+	stats        statsConfig
+	views        viewsConfig
+	errors       errorsConfig
 }
 
 type application struct {
-	config config
-	logger *slog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config      config
+	logger      *slog.Logger
+	models      data.Models
+	mailer      mailer.Mailer
+	storage     storage.Storage
+	suggestions *suggestionCache
+	views       *viewCounter
+	wg          sync.WaitGroup
+	jobs        sync.WaitGroup
 }
 
 var (
@@ -66,24 +139,6 @@ var (
 	buildTime string
 )
 
-func customHTTPErrorHandler(err error, c echo.Context) {
-	var status int
-	var message interface{}
-
-	switch e := err.(type) {
-	case *echo.HTTPError:
-		status = e.Code
-		message = e.Message
-	default:
-		status = http.StatusInternalServerError
-		message = "the server encountered a problem and could not process your request"
-	}
-
-	if !c.Response().Committed {
-		c.JSON(status, envelope{"error": message})
-	}
-}
-
 func main() {
 	envErr := godotenv.Load()
 	if envErr != nil {
@@ -114,6 +169,71 @@ func main() {
 	smtpUsername := os.Getenv("SMTP_USERNAME")
 	smtpPassword := os.Getenv("SMTP_PASSWORD")
 	smtpSender := os.Getenv("SMTP_SENDER")
+	storageDriver := os.Getenv("STORAGE_DRIVER")
+	storagePath := os.Getenv("STORAGE_PATH")
+	imageMaxBytes := os.Getenv("IMAGE_MAX_BYTES")
+	realImageMaxBytes, _ := strconv.ParseInt(imageMaxBytes, 10, 64)
+	if realImageMaxBytes <= 0 {
+		realImageMaxBytes = 10 << 20
+	}
+	trashRetention, _ := time.ParseDuration(os.Getenv("TRASH_RETENTION"))
+	if trashRetention <= 0 {
+		trashRetention = 30 * 24 * time.Hour
+	}
+	trashPurgeInterval, _ := time.ParseDuration(os.Getenv("TRASH_PURGE_INTERVAL"))
+	if trashPurgeInterval <= 0 {
+		trashPurgeInterval = time.Hour
+	}
+	importMaxBytes, _ := strconv.ParseInt(os.Getenv("IMPORT_MAX_BYTES"), 10, 64)
+	if importMaxBytes <= 0 {
+		importMaxBytes = 50 << 20
+	}
+	importSyncMaxBytes, _ := strconv.ParseInt(os.Getenv("IMPORT_SYNC_MAX_BYTES"), 10, 64)
+	if importSyncMaxBytes <= 0 {
+		importSyncMaxBytes = 1 << 20
+	}
+	requireIfMatch, _ := strconv.ParseBool(os.Getenv("REQUIRE_IF_MATCH"))
+	autocompleteCacheTTL, _ := time.ParseDuration(os.Getenv("AUTOCOMPLETE_CACHE_TTL"))
+	if autocompleteCacheTTL <= 0 {
+		autocompleteCacheTTL = 30 * time.Second
+	}
+	similarRefreshInterval, _ := time.ParseDuration(os.Getenv("SIMILAR_REFRESH_INTERVAL"))
+	if similarRefreshInterval <= 0 {
+		similarRefreshInterval = time.Hour
+	}
+	similarBatchSize, _ := strconv.Atoi(os.Getenv("SIMILAR_BATCH_SIZE"))
+	if similarBatchSize <= 0 {
+		similarBatchSize = 200
+	}
+	statsRefreshInterval, _ := time.ParseDuration(os.Getenv("STATS_REFRESH_INTERVAL"))
+	if statsRefreshInterval <= 0 {
+		statsRefreshInterval = 15 * time.Minute
+	}
+	viewsFlushInterval, _ := time.ParseDuration(os.Getenv("VIEWS_FLUSH_INTERVAL"))
+	if viewsFlushInterval <= 0 {
+		viewsFlushInterval = time.Minute
+	}
+	viewsDedupWindow, _ := time.ParseDuration(os.Getenv("VIEWS_DEDUP_WINDOW"))
+	if viewsDedupWindow <= 0 {
+		viewsDedupWindow = 30 * time.Minute
+	}
+	popularityInterval, _ := time.ParseDuration(os.Getenv("POPULARITY_REFRESH_INTERVAL"))
+	if popularityInterval <= 0 {
+		popularityInterval = 15 * time.Minute
+	}
+	problemTypeBase := os.Getenv("PROBLEM_TYPE_BASE")
+	if problemTypeBase == "" {
+		problemTypeBase = "/problems/"
+	}
+	legacyErrors, _ := strconv.ParseBool(os.Getenv("LEGACY_ERRORS"))
+	cursorSecret := []byte(os.Getenv("CURSOR_SECRET"))
+	if len(cursorSecret) == 0 {
+		// without a configured secret, cursors only stay valid until the next restart
+		cursorSecret = make([]byte, 32)
+		if _, err := rand.Read(cursorSecret); err != nil {
+			log.Fatal(err)
+		}
+	}
 	cfg := config{
 		port: realPort,
 		db: dbConfig{
@@ -134,6 +254,51 @@ func main() {
 			password: smtpPassword,
 			sender:   smtpSender,
 		},
+		storage: storageConfig{
+			driver:      storageDriver,
+			path:        storagePath,
+			s3Endpoint:  os.Getenv("S3_ENDPOINT"),
+			s3Region:    os.Getenv("S3_REGION"),
+			s3Bucket:    os.Getenv("S3_BUCKET"),
+			s3AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			s3SecretKey: os.Getenv("S3_SECRET_KEY"),
+		},
+		images: imagesConfig{
+			maxBytes: realImageMaxBytes,
+		},
+		trash: trashConfig{
+			retention:     trashRetention,
+			purgeInterval: trashPurgeInterval,
+		},
+		imports: importsConfig{
+			maxBytes:     importMaxBytes,
+			syncMaxBytes: importSyncMaxBytes,
+		},
+		etags: etagsConfig{
+			requireIfMatch: requireIfMatch,
+		},
+		cursors: cursorsConfig{
+			secret: cursorSecret,
+		},
+		autocomplete: autocompleteConfig{
+			cacheTTL: autocompleteCacheTTL,
+		},
+		similar: similarConfig{
+			refreshInterval: similarRefreshInterval,
+			batchSize:       similarBatchSize,
+		},
+		stats: statsConfig{
+			refreshInterval: statsRefreshInterval,
+		},
+		views: viewsConfig{
+			flushInterval:      viewsFlushInterval,
+			dedupWindow:        viewsDedupWindow,
+			popularityInterval: popularityInterval,
+		},
+		errors: errorsConfig{
+			typeBase: problemTypeBase,
+			legacy:   legacyErrors,
+		},
 	}
 	flag.StringVar(&cfg.env, "env", "development", "Environment(development|staging|production)")
 	flag.Parse()
@@ -145,7 +310,13 @@ func main() {
 
 	defer db.Close()
 
+	store, storageErr := openStorage(cfg)
+	if storageErr != nil {
+		log.New(os.Stdout, "", log.Ldate|log.Ltime).Fatal(storageErr)
+	}
+
 	e := echo.New()
+	e.Use(middleware.RequestID())
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
@@ -154,6 +325,7 @@ func main() {
 		LogError:         true,
 		LogMethod:        true,
 		LogContentLength: true,
+		LogRequestID:     true,
 		HandleError:      true,
 
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
@@ -163,6 +335,7 @@ func main() {
 					slog.String("uri", v.URI),
 					slog.Int("status", v.Status),
 					slog.String("content_length", v.ContentLength),
+					slog.String("request_id", v.RequestID),
 					slog.String("err", v.Error.Error()),
 				)
 			} else if v.Error == nil && v.Status == 500 {
@@ -171,6 +344,7 @@ func main() {
 					slog.String("uri", v.URI),
 					slog.Int("status", v.Status),
 					slog.String("content_length", v.ContentLength),
+					slog.String("request_id", v.RequestID),
 				)
 			} else {
 				logger.LogAttrs(context.Background(), slog.LevelInfo, "REQUEST",
@@ -178,6 +352,7 @@ func main() {
 					slog.String("uri", v.URI),
 					slog.Int("status", v.Status),
 					slog.String("content_length", v.ContentLength),
+					slog.String("request_id", v.RequestID),
 				)
 			}
 			return nil
@@ -197,20 +372,23 @@ func main() {
 			return id, nil
 		},
 		ErrorHandler: func(c echo.Context, err error) error {
-			return c.JSON(http.StatusForbidden, "Status forbidden")
+			return echo.NewHTTPError(http.StatusForbidden, "Status forbidden")
 		},
 		DenyHandler: func(c echo.Context, identifier string, err error) error {
-			return c.JSON(http.StatusTooManyRequests, "Too many requests")
+			return echo.NewHTTPError(http.StatusTooManyRequests, "Too many requests")
 		},
 	}
 
 	logger.Info("database connection pool established")
 
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:      cfg,
+		logger:      logger,
+		models:      data.NewModels(db),
+		mailer:      mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		storage:     store,
+		suggestions: newSuggestionCache(cfg.autocomplete.cacheTTL),
+		views:       newViewCounter(cfg.views.dedupWindow),
 	}
 
 	e.Use(echoprometheus.NewMiddleware("myapp"))
@@ -221,12 +399,22 @@ func main() {
 	e.Use(middleware.CORS())
 	e.Use(app.Authenticate())
 
-	e.HTTPErrorHandler = customHTTPErrorHandler
+	e.HTTPErrorHandler = app.errorHandler
 	app.routes(e)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	go app.purgeTrash(ctx)
+	go app.refreshSimilarMovies(ctx)
+	go app.refreshStats(ctx)
+	go app.saveViews(ctx)
+	go app.refreshPopularity(ctx)
+
+	if err := app.models.ImportJobs.FailInterrupted(); err != nil {
+		logger.Error(err.Error())
+	}
+
 	go func() {
 		if err := e.Start(fmt.Sprintf(":%d", cfg.port)); err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal("shutting down the server")
@@ -239,6 +427,32 @@ func main() {
 	if err := e.Shutdown(ctx); err != nil {
 		e.Logger.Fatal(err)
 	}
+
+	if err := app.flushViews(); err != nil {
+		logger.Error("saving views", "err", err.Error())
+	}
+
+	logger.Info("waiting for running jobs to complete...")
+	app.jobs.Wait()
+}
+
+func openStorage(cfg config) (storage.Storage, error) {
+	switch cfg.storage.driver {
+	case "s3":
+		region := cfg.storage.s3Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return storage.NewS3(cfg.storage.s3Endpoint, region, cfg.storage.s3Bucket, cfg.storage.s3AccessKey, cfg.storage.s3SecretKey)
+	case "", "local":
+		path := cfg.storage.path
+		if path == "" {
+			path = "./uploads"
+		}
+		return storage.NewLocal(path)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.storage.driver)
+	}
 }
 
 func openDB(cfg config) (*sql.DB, error) {
@@ -15,6 +15,10 @@ func (app *application) CustomRecover() echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			defer func() interface{} {
 				if err := recover(); err != nil {
+					// aborting handlers rely on the server to drop the connection
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
 					c.Response().Header().Set("Connection", "close")
 					return err
 				}
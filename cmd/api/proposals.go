@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) createProposalHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
+	}
+
+	var input struct {
+		BaseVersion int32           `json:"base_version"`
+		Patch       json.RawMessage `json:"patch"`
+		Rationale   string          `json:"rationale"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	proposal := &data.Proposal{
+		MovieID:     id,
+		AuthorID:    app.contextGetUser(c).ID,
+		BaseVersion: input.BaseVersion,
+		Patch:       input.Patch,
+		Rationale:   input.Rationale,
+	}
+
+	v := validator.New()
+
+	if data.ValidateProposal(v, proposal); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	if err := app.validateProposalPatch(v, proposal); err != nil {
+		return err
+	}
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	err = app.models.Proposals.Insert(proposal)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/proposals/%d", proposal.ID))
+
+	return c.JSON(http.StatusCreated, envelope{"message": "Proposal submitted successfully", "proposal": proposal})
+}
+
+func (app *application) listProposalsHandler(c echo.Context) error {
+	var input struct {
+		Status  string
+		MovieID int
+		data.Filter
+	}
+
+	v := validator.New()
+
+	input.Status = app.readString(c.QueryParams(), "status", data.ProposalPending)
+	input.MovieID = app.readInt(c.QueryParams(), "movie_id", 0, v)
+	input.Page = app.readInt(c.QueryParams(), "page", 1, v)
+	input.PageSize = app.readInt(c.QueryParams(), "page_size", 20, v)
+	input.Sort = app.readString(c.QueryParams(), "sort", "created_at")
+	input.SortSafeList = []string{"id", "created_at", "updated_at", "-id", "-created_at", "-updated_at"}
+
+	v.Check(input.Status == "all" || validator.In(input.Status, data.ProposalStatuses...), "status", validator.CodeNotAllowed, "status must be one of pending, approved, rejected, changes_requested or all")
+
+	if data.ValidateFilters(v, &input.Filter); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	if input.Status == "all" {
+		input.Status = ""
+	}
+
+	proposals, metaData, err := app.models.Proposals.GetAll(input.Status, input.MovieID, input.Filter)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Proposals returned successfully", "metadata": metaData, "proposals": proposals})
+}
+
+func (app *application) showProposalHandler(c echo.Context) error {
+	proposal, err := app.readProposal(c, false)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Proposal returned successfully", "proposal": proposal})
+}
+
+func (app *application) diffProposalHandler(c echo.Context) error {
+	proposal, err := app.readProposal(c, false)
+	if err != nil {
+		return err
+	}
+
+	base, err := app.models.Revisions.Get(proposal.MovieID, proposal.BaseVersion)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Base revision not found")
+		default:
+			return err
+		}
+	}
+
+	patched, err := data.ApplyMergePatch(base.Snapshot, proposal.Patch)
+	if err != nil {
+		return err
+	}
+
+	changes, err := data.DiffSnapshots(base.Snapshot, patched)
+	if err != nil {
+		return err
+	}
+
+	stale := true
+	movie, err := app.models.Movies.Get(proposal.MovieID)
+	switch {
+	case err == nil:
+		stale = movie.Version != proposal.BaseVersion
+	case !errors.Is(err, data.ErrNoRecordFound):
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"message":      "Proposal compared successfully",
+		"base_version": proposal.BaseVersion,
+		"stale":        stale,
+		"changes":      changes,
+	})
+}
+
+func (app *application) updateProposalHandler(c echo.Context) error {
+	proposal, err := app.readProposal(c, true)
+	if err != nil {
+		return err
+	}
+
+	if proposal.Status != data.ProposalPending && proposal.Status != data.ProposalChangesRequested {
+		return echo.NewHTTPError(http.StatusConflict, "only pending proposals or proposals with requested changes can be edited")
+	}
+
+	var input struct {
+		BaseVersion *int32          `json:"base_version,omitempty"`
+		Patch       json.RawMessage `json:"patch,omitempty"`
+		Rationale   *string         `json:"rationale,omitempty"`
+		Version     *int32          `json:"version,omitempty"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if input.Version != nil && *input.Version != proposal.Version {
+		return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+	}
+
+	if input.BaseVersion != nil {
+		proposal.BaseVersion = *input.BaseVersion
+	}
+	if input.Patch != nil {
+		proposal.Patch = input.Patch
+	}
+	if input.Rationale != nil {
+		proposal.Rationale = *input.Rationale
+	}
+	proposal.Status = data.ProposalPending
+
+	v := validator.New()
+
+	if data.ValidateProposal(v, proposal); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	if err := app.validateProposalPatch(v, proposal); err != nil {
+		return err
+	}
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	err = app.models.Proposals.Update(proposal)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+		default:
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Proposal updated successfully", "proposal": proposal})
+}
+
+func (app *application) approveProposalHandler(c echo.Context) error {
+	proposal, err := app.readPendingProposal(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Note string `json:"note"`
+	}
+
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&input); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	base, err := app.models.Revisions.Get(proposal.MovieID, proposal.BaseVersion)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+		default:
+			return err
+		}
+	}
+
+	movie, err := data.ApplyMergePatch(base.Snapshot, proposal.Patch)
+	if err != nil {
+		return err
+	}
+	movie.ID = proposal.MovieID
+	movie.Version = proposal.BaseVersion
+
+	v := validator.New()
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	moderator := app.contextGetUser(c)
+	proposal.ModeratorNote = input.Note
+
+	// Approve only succeeds while the movie is still at the version the proposal
+	// was written against, so a stale proposal can never overwrite newer edits.
+	// The movie and the proposal are updated together, so a proposal can't be
+	// left pending once it has been applied.
+	err = app.models.Proposals.Approve(proposal, movie, moderator.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return echo.NewHTTPError(http.StatusConflict, "the movie has changed since this proposal was submitted, request changes so the author can update it")
+		case errors.Is(err, data.ErrProposalConflict):
+			return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+		case errors.Is(err, data.ErrTrashedExternalID):
+			v.AddError("external_ids", validator.CodeConflict, "an external id belongs to a movie in the trash, restore or purge that movie first")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", validator.CodeNotUnique, "an external id already points at another movie")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		default:
+			return err
+		}
+	}
+
+	return app.notifyProposalAuthor(c, proposal, "Proposal approved successfully")
+}
+
+func (app *application) rejectProposalHandler(c echo.Context) error {
+	return app.moderateProposal(c, data.ProposalRejected, "Proposal rejected successfully")
+}
+
+func (app *application) requestProposalChangesHandler(c echo.Context) error {
+	return app.moderateProposal(c, data.ProposalChangesRequested, "Changes requested successfully")
+}
+
+func (app *application) moderateProposal(c echo.Context, status, message string) error {
+	proposal, err := app.readPendingProposal(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	v := validator.New()
+
+	v.Check(input.Reason != "", "reason", validator.CodeRequired, "reason must be provided")
+	v.Check(validator.MaxChars(input.Reason, 2000), "reason", validator.CodeTooLong, "reason should be less than or equal to 2000 characters long")
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	moderator := app.contextGetUser(c)
+
+	proposal.Status = status
+	proposal.ModeratorID = &moderator.ID
+	proposal.ModeratorNote = input.Reason
+
+	return app.finishProposal(c, proposal, message)
+}
+
+// finishProposal stores the moderation outcome and lets the author know about it.
+func (app *application) finishProposal(c echo.Context, proposal *data.Proposal, message string) error {
+	err := app.models.Proposals.Update(proposal)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+		default:
+			return err
+		}
+	}
+
+	return app.notifyProposalAuthor(c, proposal, message)
+}
+
+// notifyProposalAuthor lets the author know about the moderation outcome.
+func (app *application) notifyProposalAuthor(c echo.Context, proposal *data.Proposal, message string) error {
+	app.background(func() {
+		data := map[string]interface{}{
+			"Name":       proposal.AuthorName,
+			"ProposalID": proposal.ID,
+			"MovieID":    proposal.MovieID,
+			"Note":       proposal.ModeratorNote,
+		}
+		err := app.mailer.Send(proposal.AuthorEmail, "proposal_"+proposal.Status+".tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	return c.JSON(http.StatusOK, envelope{"message": message, "proposal": proposal})
+}
+
+// readProposal loads the proposal named by the id parameter. Proposals are only
+// visible to their author and to moderators, and only the author may change them.
+func (app *application) readProposal(c echo.Context, authorOnly bool) (*data.Proposal, error) {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	proposal, err := app.models.Proposals.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Proposal not found")
+		default:
+			return nil, err
+		}
+	}
+
+	user := app.contextGetUser(c)
+	if proposal.AuthorID == user.ID {
+		return proposal, nil
+	}
+
+	if !authorOnly {
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if permissions.Include("movies:moderate") {
+			return proposal, nil
+		}
+	}
+	return nil, echo.NewHTTPError(http.StatusNotFound, "Proposal not found")
+}
+
+func (app *application) readPendingProposal(c echo.Context) (*data.Proposal, error) {
+	proposal, err := app.readProposal(c, false)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != data.ProposalPending {
+		return nil, echo.NewHTTPError(http.StatusConflict, "only pending proposals can be moderated")
+	}
+	return proposal, nil
+}
+
+// validateProposalPatch checks that the base version exists and that applying
+// the patch to it produces a valid movie.
+func (app *application) validateProposalPatch(v *validator.Validator, proposal *data.Proposal) error {
+	base, err := app.models.Revisions.Get(proposal.MovieID, proposal.BaseVersion)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			v.AddError("base_version", validator.CodeInvalid, "base_version does not match a version of this movie")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	patched, err := data.ApplyMergePatch(base.Snapshot, proposal.Patch)
+	if err != nil {
+		v.AddError("patch", validator.CodeInvalid, err.Error())
+		return nil
+	}
+
+	data.ValidateMovie(v, patched)
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type similarMovie struct {
+	Movie interface{} `json:"movie"`
+	*data.SimilarMovie
+}
+
+type recommendedMovie struct {
+	Movie interface{} `json:"movie"`
+	*data.Recommendation
+}
+
+type watchlistEntry struct {
+	Movie   interface{} `json:"movie"`
+	AddedAt time.Time   `json:"added_at"`
+}
+
+// renderMovies reads the movies with the given ids as the view asks for and
+// returns them rendered by id. Movies that don't exist anymore are missing.
+func (app *application) renderMovies(c echo.Context, view movieView, ids []int) (map[int]interface{}, error) {
+	movies, err := app.models.Movies.GetMany(ids, view.fields...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.loadMovieDetails(c, view, movies...)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make(map[int]interface{}, len(movies))
+	for _, movie := range movies {
+		r, err := view.render(movie)
+		if err != nil {
+			return nil, err
+		}
+		rendered[movie.ID] = r
+	}
+	return rendered, nil
+}
+
+// readMovieListView reads the limit and the view of the movie lists that are
+// computed for a movie or a user.
+func (app *application) readMovieListView(c echo.Context) (int, movieView, error) {
+	v := validator.New()
+
+	limit := app.readInt(c.QueryParams(), "limit", 20, v)
+	v.Check(limit >= 1 && limit <= 100, "limit", validator.CodeOutOfRange, "limit must be between 1 and 100")
+
+	view := app.readMovieView(c.QueryParams(), v, "images")
+
+	if !v.Valid() {
+		return 0, movieView{}, echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+	return limit, view, nil
+}
+
+func (app *application) similarMoviesHandler(c echo.Context) error {
+	id, err := app.readMovieIDParam(c)
+	if err == nil {
+		_, err = app.models.Movies.Get(id)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
+	}
+
+	limit, view, err := app.readMovieListView(c)
+	if err != nil {
+		return err
+	}
+
+	similar, err := app.models.Similarities.GetSimilar(id, limit)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, len(similar))
+	for i, s := range similar {
+		ids[i] = s.MovieID
+	}
+
+	rendered, err := app.renderMovies(c, view, ids)
+	if err != nil {
+		return err
+	}
+
+	movies := make([]similarMovie, 0, len(similar))
+	for _, s := range similar {
+		if movie, ok := rendered[s.MovieID]; ok {
+			movies = append(movies, similarMovie{Movie: movie, SimilarMovie: s})
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Similar movies returned successfully", "similar": movies})
+}
+
+func (app *application) recommendationsHandler(c echo.Context) error {
+	user := app.contextGetUser(c)
+
+	limit, view, err := app.readMovieListView(c)
+	if err != nil {
+		return err
+	}
+
+	recommendations, err := app.models.Similarities.Recommend(user.ID, limit)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, len(recommendations))
+	for i, r := range recommendations {
+		ids[i] = r.MovieID
+	}
+
+	rendered, err := app.renderMovies(c, view, ids)
+	if err != nil {
+		return err
+	}
+
+	movies := make([]recommendedMovie, 0, len(recommendations))
+	for _, r := range recommendations {
+		if movie, ok := rendered[r.MovieID]; ok {
+			movies = append(movies, recommendedMovie{Movie: movie, Recommendation: r})
+		}
+	}
+
+	c.Response().Header().Set("Cache-Control", "private, no-cache")
+
+	return c.JSON(http.StatusOK, envelope{"message": "Recommendations returned successfully", "recommendations": movies})
+}
+
+func (app *application) rateMovieHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
+	}
+
+	var input struct {
+		Score int `json:"score"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	rating := &data.Rating{MovieID: id, Score: input.Score}
+
+	v := validator.New()
+
+	if data.ValidateRating(v, rating); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	err = app.models.Ratings.Upsert(app.contextGetUser(c).ID, rating)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Movie rated successfully", "rating": rating})
+}
+
+func (app *application) deleteMovieRatingHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	err = app.models.Ratings.Delete(app.contextGetUser(c).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Rating not found")
+		default:
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Rating deleted successfully"})
+}
+
+func (app *application) listWatchlistHandler(c echo.Context) error {
+	v := validator.New()
+
+	view := app.readMovieView(c.QueryParams(), v, "images")
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	items, err := app.models.Watchlist.GetAll(app.contextGetUser(c).ID)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.MovieID
+	}
+
+	rendered, err := app.renderMovies(c, view, ids)
+	if err != nil {
+		return err
+	}
+
+	watchlist := make([]watchlistEntry, 0, len(items))
+	for _, item := range items {
+		if movie, ok := rendered[item.MovieID]; ok {
+			watchlist = append(watchlist, watchlistEntry{Movie: movie, AddedAt: item.CreatedAt})
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Watchlist returned successfully", "watchlist": watchlist})
+}
+
+func (app *application) addToWatchlistHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
+	}
+
+	item, err := app.models.Watchlist.Add(app.contextGetUser(c).ID, id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Movie added to the watchlist successfully", "item": item})
+}
+
+func (app *application) removeFromWatchlistHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	err = app.models.Watchlist.Remove(app.contextGetUser(c).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found in the watchlist")
+		default:
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Movie removed from the watchlist successfully"})
+}
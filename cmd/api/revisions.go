@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) listMovieRevisionsHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	var input data.Filter
+
+	v := validator.New()
+
+	input.Page = app.readInt(c.QueryParams(), "page", 1, v)
+	input.PageSize = app.readInt(c.QueryParams(), "page_size", 20, v)
+	input.Sort = app.readString(c.QueryParams(), "sort", "-version")
+	input.SortSafeList = []string{"version", "-version"}
+
+	if data.ValidateFilters(v, &input); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	revisions, metaData, err := app.models.Revisions.GetAll(id, input)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 && input.Page == 1 {
+		return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Revisions returned successfully", "metadata": metaData, "revisions": revisions})
+}
+
+func (app *application) showMovieRevisionHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	version, err := app.readIntParam(c, "version")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	revision, err := app.models.Revisions.Get(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Revision not found")
+		default:
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Revision returned successfully", "revision": revision})
+}
+
+func (app *application) diffMovieRevisionsHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	v := validator.New()
+
+	from := app.readInt(c.QueryParams(), "from", 0, v)
+	to := app.readInt(c.QueryParams(), "to", 0, v)
+
+	v.Check(from >= 1, "from", validator.CodeRequired, "from must be provided and a positive integer")
+	v.Check(to >= 1, "to", validator.CodeRequired, "to must be provided and a positive integer")
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	fromRevision, err := app.models.Revisions.Get(id, int32(from))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Revision %d not found", from))
+		default:
+			return err
+		}
+	}
+
+	toRevision, err := app.models.Revisions.Get(id, int32(to))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Revision %d not found", to))
+		default:
+			return err
+		}
+	}
+
+	changes, err := data.DiffSnapshots(fromRevision.Snapshot, toRevision.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{
+		"message": "Revisions compared successfully",
+		"from":    from,
+		"to":      to,
+		"changes": changes,
+	})
+}
+
+func (app *application) restoreMovieRevisionHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	version, err := app.readIntParam(c, "version")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	var input struct {
+		Version *int32 `json:"version"`
+	}
+
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&input); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	revision, err := app.models.Revisions.Get(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Revision not found")
+		default:
+			return err
+		}
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
+	}
+
+	if input.Version != nil && *input.Version != movie.Version {
+		return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+	}
+
+	snapshot := revision.Snapshot
+	movie.Title = snapshot.Title
+	movie.Year = snapshot.Year
+	movie.Runtime = snapshot.Runtime
+	movie.Genres = snapshot.Genres
+	movie.Localizations = snapshot.Localizations
+	movie.Releases = snapshot.Releases
+	movie.Certifications = snapshot.Certifications
+	movie.ExternalIDs = snapshot.ExternalIDs
+
+	v := validator.New()
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	err = app.models.Movies.Restore(movie, app.contextGetUser(c).ID, revision.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+		case errors.Is(err, data.ErrTrashedExternalID):
+			v.AddError("external_ids", validator.CodeConflict, "an external id belongs to a movie in the trash, restore or purge that movie first")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", validator.CodeNotUnique, "an external id of this revision now points at another movie")
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+		default:
+			return err
+		}
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+
+	return c.JSON(http.StatusOK, envelope{"message": "Revision restored successfully", "movie": movie})
+}
@@ -9,11 +9,63 @@ func (app *application) routes(e *echo.Echo) {
 
 	router.GET("/movies", app.getMoviesHandler, app.RequirePermission("movies:read"))
 	router.POST("/movies", app.createMovieHandler, app.RequirePermission("movies:write"))
+	router.POST("/movies/batch", app.batchWriteMoviesHandler, app.RequirePermission("movies:write"))
+	router.POST("/movies/batch-get", app.batchGetMoviesHandler, app.RequirePermission("movies:read"))
+	router.GET("/movies/trending", app.trendingMoviesHandler, app.RequirePermission("movies:read"))
+	router.GET("/movies/autocomplete", app.autocompleteHandler, app.RequirePermission("movies:read"))
+	router.GET("/movies/export", app.exportMoviesHandler, app.RequirePermission("movies:export"))
+	router.POST("/movies/import", app.importMoviesHandler, app.RequirePermission("movies:write"))
+	router.GET("/movies/import/:id", app.showImportHandler, app.RequirePermission("movies:write"))
+	router.GET("/movies/lookup", app.lookupMovieHandler, app.RequirePermission("movies:read"))
 	router.GET("/movies/:id", app.showMovieHandler, app.RequirePermission("movies:read"))
 	router.PATCH("/movies/:id", app.updateMovieHandler, app.RequirePermission("movies:write"))
 	router.DELETE("/movies/:id", app.deleteMovieHandler, app.RequirePermission("movies:write"))
 
+	router.GET("/movies/:id/images", app.listMovieImagesHandler, app.RequirePermission("movies:read"))
+	router.POST("/movies/:id/images", app.uploadMovieImageHandler, app.RequirePermission("movies:write"))
+	router.DELETE("/movies/:id/images/:image_id", app.deleteMovieImageHandler, app.RequirePermission("movies:write"))
+	router.GET("/movies/:id/videos", app.listMovieVideosHandler, app.RequirePermission("movies:read"))
+	router.POST("/movies/:id/videos", app.createMovieVideoHandler, app.RequirePermission("movies:write"))
+	router.GET("/movies/:id/videos/:video_id", app.showMovieVideoHandler, app.RequirePermission("movies:read"))
+	router.PATCH("/movies/:id/videos/:video_id", app.updateMovieVideoHandler, app.RequirePermission("movies:write"))
+	router.DELETE("/movies/:id/videos/:video_id", app.deleteMovieVideoHandler, app.RequirePermission("movies:write"))
+
+	router.GET("/movies/:id/similar", app.similarMoviesHandler, app.RequirePermission("movies:read"))
+	router.PUT("/movies/:id/rating", app.rateMovieHandler, app.RequirePermission("movies:read"))
+	router.DELETE("/movies/:id/rating", app.deleteMovieRatingHandler, app.RequirePermission("movies:read"))
+
+	router.GET("/movies/:id/revisions", app.listMovieRevisionsHandler, app.RequirePermission("movies:read"))
+	router.GET("/movies/:id/revisions/diff", app.diffMovieRevisionsHandler, app.RequirePermission("movies:read"))
+	router.GET("/movies/:id/revisions/:version", app.showMovieRevisionHandler, app.RequirePermission("movies:read"))
+	router.POST("/movies/:id/revisions/:version/restore", app.restoreMovieRevisionHandler, app.RequirePermission("movies:write"))
+
+	router.POST("/movies/:id/proposals", app.createProposalHandler, app.RequirePermission("movies:read"))
+	router.GET("/proposals", app.listProposalsHandler, app.RequirePermission("movies:moderate"))
+	router.GET("/proposals/:id", app.showProposalHandler, app.RequirePermission("movies:read"))
+	router.GET("/proposals/:id/diff", app.diffProposalHandler, app.RequirePermission("movies:read"))
+	router.PATCH("/proposals/:id", app.updateProposalHandler, app.RequirePermission("movies:read"))
+	router.POST("/proposals/:id/approve", app.approveProposalHandler, app.RequirePermission("movies:moderate"))
+	router.POST("/proposals/:id/reject", app.rejectProposalHandler, app.RequirePermission("movies:moderate"))
+	router.POST("/proposals/:id/request-changes", app.requestProposalChangesHandler, app.RequirePermission("movies:moderate"))
+
+	router.GET("/admin/movies/duplicates", app.listDuplicateMoviesHandler, app.RequirePermission("movies:merge"))
+	router.POST("/admin/movies/merge", app.mergeMoviesHandler, app.RequirePermission("movies:merge"))
+
+	router.GET("/trash/movies", app.listTrashHandler, app.RequirePermission("movies:write"))
+	router.POST("/trash/movies/:id/restore", app.restoreTrashHandler, app.RequirePermission("movies:write"))
+	router.DELETE("/trash/movies/:id", app.purgeTrashHandler, app.RequirePermission("movies:purge"))
+
+	router.GET("/images/:id/:variant", app.serveImageHandler)
+
+	router.GET("/stats", app.statsHandler, app.RequirePermission("movies:read"))
+
+	router.GET("/releases/upcoming", app.upcomingReleasesHandler, app.RequirePermission("movies:read"))
+
 	router.POST("/users", app.registerUserHandler)
 	router.PUT("/users/activated", app.activateUserHandler)
 	router.POST("/users/authentication", app.authenticationTokenHandler)
+	router.GET("/users/me/recommendations", app.recommendationsHandler, app.RequirePermission("movies:read"))
+	router.GET("/users/me/watchlist", app.listWatchlistHandler, app.RequirePermission("movies:read"))
+	router.PUT("/users/me/watchlist/:id", app.addToWatchlistHandler, app.RequirePermission("movies:read"))
+	router.DELETE("/users/me/watchlist/:id", app.removeFromWatchlistHandler, app.RequirePermission("movies:read"))
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) statsHandler(c echo.Context) error {
+	v := validator.New()
+
+	search := app.readMovieSearch(c, v)
+	months := app.readInt(c.QueryParams(), "months", 12, v)
+
+	data.ValidateMovieSearch(v, search)
+	v.Check(months >= 1 && months <= 120, "months", validator.CodeOutOfRange, "months must be between 1 and 120")
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	stats, err := app.models.Stats.Get(search, months)
+	if err != nil {
+		return err
+	}
+
+	// the title is searched in the language the client prefers
+	c.Response().Header().Add("Vary", "Accept-Language")
+
+	etag, err := weakETag(stats)
+	if err != nil {
+		return err
+	}
+	if app.notModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Statistics returned successfully", "stats": stats})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) listTrashHandler(c echo.Context) error {
+	var input data.Filter
+
+	v := validator.New()
+
+	input.Page = app.readInt(c.QueryParams(), "page", 1, v)
+	input.PageSize = app.readInt(c.QueryParams(), "page_size", 20, v)
+	input.Sort = app.readString(c.QueryParams(), "sort", "-deleted_at")
+	input.SortSafeList = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, &input); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	movies, metaData, err := app.models.Movies.GetTrash(input)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Trash returned successfully", "metadata": metaData, "movies": movies})
+}
+
+func (app *application) restoreTrashHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	movie, err := app.models.Movies.Undelete(id, app.contextGetUser(c).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found in the trash")
+		default:
+			return err
+		}
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+
+	return c.JSON(http.StatusOK, envelope{"message": "Movie restored successfully", "movie": movie})
+}
+
+func (app *application) purgeTrashHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	images, err := app.models.Movies.Purge(id, app.contextGetUser(c).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found in the trash")
+		default:
+			return err
+		}
+	}
+
+	app.background(func() {
+		for _, image := range images {
+			app.deleteImageFiles(image)
+		}
+	})
+
+	return c.JSON(http.StatusOK, envelope{"message": "Movie purged successfully"})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (app *application) listMovieVideosHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
+	}
+
+	videos, err := app.models.Videos.GetForMovie(id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Videos returned successfully", "videos": videos})
+}
+
+func (app *application) createMovieVideoHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Movie not found")
+		default:
+			return err
+		}
+	}
+
+	var input struct {
+		Site        string     `json:"site"`
+		Key         string     `json:"key"`
+		URL         string     `json:"url"`
+		Type        string     `json:"type"`
+		Language    string     `json:"language"`
+		Official    bool       `json:"official"`
+		PublishedAt *time.Time `json:"published_at"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	video := &data.Video{
+		MovieID:     id,
+		Site:        input.Site,
+		Key:         input.Key,
+		URL:         input.URL,
+		Type:        input.Type,
+		Language:    input.Language,
+		Official:    input.Official,
+		PublishedAt: input.PublishedAt,
+	}
+	video.ResolveKey()
+
+	v := validator.New()
+
+	if data.ValidateVideo(v, video); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	err = app.models.Videos.Insert(video)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("/v1/movies/%d/videos/%d", id, video.ID))
+
+	return c.JSON(http.StatusCreated, envelope{"message": "Video created successfully", "video": video})
+}
+
+func (app *application) showMovieVideoHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	videoID, err := app.readIntParam(c, "video_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	video, err := app.models.Videos.Get(id, videoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Video not found")
+		default:
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Video returned successfully", "video": video})
+}
+
+func (app *application) updateMovieVideoHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	videoID, err := app.readIntParam(c, "video_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	video, err := app.models.Videos.Get(id, videoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Video not found")
+		default:
+			return err
+		}
+	}
+
+	var input struct {
+		Site        *string    `json:"site,omitempty"`
+		Key         *string    `json:"key,omitempty"`
+		URL         *string    `json:"url,omitempty"`
+		Type        *string    `json:"type,omitempty"`
+		Language    *string    `json:"language,omitempty"`
+		Official    *bool      `json:"official,omitempty"`
+		PublishedAt *time.Time `json:"published_at,omitempty"`
+	}
+
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if input.Site != nil {
+		video.Site = *input.Site
+	}
+	if input.Key != nil {
+		video.Key = *input.Key
+		if input.URL == nil {
+			video.URL = ""
+		}
+	}
+	if input.URL != nil {
+		video.URL = *input.URL
+		if input.Key == nil {
+			video.Key = ""
+		}
+	}
+	if input.Type != nil {
+		video.Type = *input.Type
+	}
+	if input.Language != nil {
+		video.Language = *input.Language
+	}
+	if input.Official != nil {
+		video.Official = *input.Official
+	}
+	if input.PublishedAt != nil {
+		video.PublishedAt = input.PublishedAt
+	}
+	video.ResolveKey()
+
+	v := validator.New()
+
+	if data.ValidateVideo(v, video); !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	err = app.models.Videos.Update(video)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return echo.NewHTTPError(http.StatusConflict, data.ErrEditConflict.Error())
+		default:
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Video updated successfully", "video": video})
+}
+
+func (app *application) deleteMovieVideoHandler(c echo.Context) error {
+	id, err := app.readIDParam(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	videoID, err := app.readIntParam(c, "video_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	err = app.models.Videos.Delete(id, videoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Video not found")
+		default:
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Video deleted successfully"})
+}
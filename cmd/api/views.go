@@ -0,0 +1,223 @@
+package main
+
+import (
+	"movies/internal/data"
+	"movies/internal/validator"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// botUserAgents are the user agent fragments of the crawlers and tools whose
+// requests aren't counted as views.
+var botUserAgents = []string{"bot", "crawl", "spider", "slurp", "headless", "preview", "curl", "wget"}
+
+// maxViewKeys caps how many client and movie pairs a viewCounter remembers
+// for deduplicating views, a single client going through the catalogue mustn't
+// grow it without bound between flushes.
+const maxViewKeys = 100000
+
+type viewKey struct {
+	client     string
+	movieID    int
+	impression bool
+}
+
+type trendingMovie struct {
+	Movie interface{} `json:"movie"`
+	*data.TrendingMovie
+}
+
+// viewCounter counts the views of movies and their appearances in lists until
+// they are flushed to the database. A client is only counted once per movie
+// within the dedup window. Once it remembers maxViewKeys pairs, new pairs
+// aren't counted until some of them leave the window.
+type viewCounter struct {
+	mu          sync.Mutex
+	window      time.Duration
+	seen        map[viewKey]time.Time
+	fullUntil   time.Time
+	views       map[int]int
+	impressions map[int]int
+}
+
+func newViewCounter(window time.Duration) *viewCounter {
+	return &viewCounter{
+		window:      window,
+		seen:        make(map[viewKey]time.Time),
+		views:       make(map[int]int),
+		impressions: make(map[int]int),
+	}
+}
+
+func (vc *viewCounter) record(client string, impression bool, ids ...int) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	now := time.Now()
+
+	for _, id := range ids {
+		key := viewKey{client: client, movieID: id, impression: impression}
+		last, ok := vc.seen[key]
+		if ok && now.Sub(last) < vc.window {
+			continue
+		}
+		if !ok && len(vc.seen) >= maxViewKeys && !vc.prune(now) {
+			continue
+		}
+		vc.seen[key] = now
+
+		if impression {
+			vc.impressions[id]++
+		} else {
+			vc.views[id]++
+		}
+	}
+}
+
+// prune forgets the clients seen before the dedup window and reports whether
+// that made room. While full, it doesn't look again before the oldest pair
+// leaves the window.
+func (vc *viewCounter) prune(now time.Time) bool {
+	if now.Before(vc.fullUntil) {
+		return false
+	}
+
+	var oldest time.Time
+	for key, last := range vc.seen {
+		if now.Sub(last) >= vc.window {
+			delete(vc.seen, key)
+		} else if oldest.IsZero() || last.Before(oldest) {
+			oldest = last
+		}
+	}
+
+	if len(vc.seen) >= maxViewKeys {
+		vc.fullUntil = oldest.Add(vc.window)
+		return false
+	}
+	return true
+}
+
+// take returns the counts since the last call and starts over. Clients seen
+// before the dedup window are forgotten.
+func (vc *viewCounter) take() (map[int]int, map[int]int) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	views, impressions := vc.views, vc.impressions
+	vc.views, vc.impressions = make(map[int]int), make(map[int]int)
+
+	vc.prune(time.Now())
+	return views, impressions
+}
+
+// restore adds back counts returned by take that couldn't be written.
+func (vc *viewCounter) restore(views, impressions map[int]int) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	for id, n := range views {
+		vc.views[id] += n
+	}
+	for id, n := range impressions {
+		vc.impressions[id] += n
+	}
+}
+
+// viewClient identifies the client of the request for deduplicating views.
+// It reports false for bots, whose views aren't counted.
+func (app *application) viewClient(c echo.Context) (string, bool) {
+	userAgent := c.Request().UserAgent()
+	if userAgent == "" {
+		return "", false
+	}
+	lower := strings.ToLower(userAgent)
+	for _, bot := range botUserAgents {
+		if strings.Contains(lower, bot) {
+			return "", false
+		}
+	}
+
+	if user := app.contextGetUser(c); !user.IsAnonymous() {
+		return "user:" + strconv.Itoa(user.ID), true
+	}
+	return "ip:" + c.RealIP() + "|" + userAgent, true
+}
+
+// recordView counts a view of the movie.
+func (app *application) recordView(c echo.Context, id int) {
+	if client, ok := app.viewClient(c); ok {
+		app.views.record(client, false, id)
+	}
+}
+
+// recordImpressions counts the appearance of the movies in a list.
+func (app *application) recordImpressions(c echo.Context, movies []*data.Movie) {
+	client, ok := app.viewClient(c)
+	if !ok || len(movies) == 0 {
+		return
+	}
+
+	ids := make([]int, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	app.views.record(client, true, ids...)
+}
+
+// flushViews writes the views counted so far to the database. Counts that
+// couldn't be written are kept for the next flush.
+func (app *application) flushViews() error {
+	views, impressions := app.views.take()
+
+	err := app.models.Views.Record(views, impressions)
+	if err != nil {
+		app.views.restore(views, impressions)
+	}
+	return err
+}
+
+func (app *application) trendingMoviesHandler(c echo.Context) error {
+	v := validator.New()
+
+	window := app.readString(c.QueryParams(), "window", data.TrendingDay)
+	limit := app.readInt(c.QueryParams(), "limit", 20, v)
+
+	v.Check(validator.In(window, data.TrendingWindows...), "window", validator.CodeNotAllowed, "window must be one of "+strings.Join(data.TrendingWindows, ", "))
+	v.Check(limit >= 1 && limit <= 100, "limit", validator.CodeOutOfRange, "limit must be between 1 and 100")
+
+	view := app.readMovieView(c.QueryParams(), v, "images")
+
+	if !v.Valid() {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, v)
+	}
+
+	trending, err := app.models.Views.Trending(window, limit)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, len(trending))
+	for i, t := range trending {
+		ids[i] = t.MovieID
+	}
+
+	rendered, err := app.renderMovies(c, view, ids)
+	if err != nil {
+		return err
+	}
+
+	movies := make([]trendingMovie, 0, len(trending))
+	for _, t := range trending {
+		if movie, ok := rendered[t.MovieID]; ok {
+			movies = append(movies, trendingMovie{Movie: movie, TrendingMovie: t})
+		}
+	}
+
+	return c.JSON(http.StatusOK, envelope{"message": "Trending movies returned successfully", "trending": movies})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	stageTitles  = "title.basics"
+	stageNames   = "name.basics"
+	stageCredits = "title.principals"
+)
+
+var stagingTables = map[string]string{
+	stageTitles:  "ingest_title_basics",
+	stageNames:   "ingest_name_basics",
+	stageCredits: "ingest_title_principals",
+}
+
+type checkpoint struct {
+	Stage        string
+	FileName     string
+	FileSize     int64
+	FileModified time.Time
+	Loaded       bool
+	Completed    bool
+	LastKey      string
+	Inserted     int64
+	Updated      int64
+	Skipped      int64
+}
+
+// openCheckpoint returns the progress of a stage for the given file. When no
+// progress was recorded, the file has changed since, or a restart is asked for,
+// the stage starts over from an empty staging table.
+func (in *ingester) openCheckpoint(ctx context.Context, stage, path string) (*checkpoint, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &checkpoint{
+		Stage:        stage,
+		FileName:     filepath.Base(path),
+		FileSize:     info.Size(),
+		FileModified: info.ModTime().Truncate(time.Second),
+	}
+
+	query := `SELECT file_name, file_size, file_modified, loaded, completed, last_key, inserted, updated, skipped
+	FROM ingest_checkpoints
+	WHERE stage = $1`
+
+	var saved checkpoint
+	err = in.db.QueryRowContext(ctx, query, stage).Scan(
+		&saved.FileName,
+		&saved.FileSize,
+		&saved.FileModified,
+		&saved.Loaded,
+		&saved.Completed,
+		&saved.LastKey,
+		&saved.Inserted,
+		&saved.Updated,
+		&saved.Skipped,
+	)
+	switch {
+	case err == nil && !in.config.restart && saved.FileName == cp.FileName && saved.FileSize == cp.FileSize && saved.FileModified.Equal(cp.FileModified):
+		saved.Stage = stage
+		return &saved, nil
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	_, err = in.db.ExecContext(ctx, `TRUNCATE `+stagingTables[stage])
+	if err != nil {
+		return nil, err
+	}
+	return cp, in.saveCheckpoint(ctx, in.db, cp)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (in *ingester) saveCheckpoint(ctx context.Context, db execer, cp *checkpoint) error {
+	query := `INSERT INTO ingest_checkpoints (stage, file_name, file_size, file_modified, loaded, completed, last_key, inserted, updated, skipped)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT (stage) DO UPDATE
+	SET file_name = EXCLUDED.file_name, file_size = EXCLUDED.file_size, file_modified = EXCLUDED.file_modified,
+	loaded = EXCLUDED.loaded, completed = EXCLUDED.completed, last_key = EXCLUDED.last_key,
+	inserted = EXCLUDED.inserted, updated = EXCLUDED.updated, skipped = EXCLUDED.skipped, updated_at = NOW()`
+
+	_, err := db.ExecContext(ctx, query, cp.Stage, cp.FileName, cp.FileSize, cp.FileModified, cp.Loaded, cp.Completed, cp.LastKey, cp.Inserted, cp.Updated, cp.Skipped)
+	return err
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"movies/internal/validator"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// skippedCategories are principals that appear as themselves or in archive
+// footage rather than taking part in the making of the movie.
+var skippedCategories = []string{"self", "archive_footage", "archive_sound"}
+
+func (in *ingester) ingestNames(ctx context.Context, path string) (*checkpoint, error) {
+	cp, err := in.openCheckpoint(ctx, stageNames, path)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Completed {
+		in.logger.Info("already ingested, skipping", "stage", stageNames)
+		return cp, nil
+	}
+
+	in.logger.Info("loading", "stage", stageNames, "file", path)
+
+	r, err := openTSV(path, "nconst", "primaryName")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	err = withTx(ctx, in.db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("ingest_name_basics", "nconst", "name"))
+		if err != nil {
+			return err
+		}
+
+		for r.Next() {
+			if r.Get("primaryName") == "" {
+				cp.Skipped++
+				continue
+			}
+			if _, err := stmt.ExecContext(ctx, r.Get("nconst"), r.Get("primaryName")); err != nil {
+				return err
+			}
+			cp.Inserted++
+		}
+		if err := r.Err(); err != nil {
+			return err
+		}
+
+		if _, err := stmt.ExecContext(ctx); err != nil {
+			return err
+		}
+		if err := stmt.Close(); err != nil {
+			return err
+		}
+
+		// names are only staged, they are picked up when merging the credits
+		cp.Loaded = true
+		cp.Completed = true
+		return in.saveCheckpoint(ctx, tx, cp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func (in *ingester) ingestCredits(ctx context.Context, path string) (*checkpoint, error) {
+	cp, err := in.openCheckpoint(ctx, stageCredits, path)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Completed {
+		in.logger.Info("already ingested, skipping", "stage", stageCredits)
+		return cp, nil
+	}
+
+	if !cp.Loaded {
+		err := in.loadPrincipals(ctx, path, cp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		done, err := in.mergeCredits(ctx, cp)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+
+	cp.Completed = true
+	return cp, in.saveCheckpoint(ctx, in.db, cp)
+}
+
+func (in *ingester) loadPrincipals(ctx context.Context, path string, cp *checkpoint) error {
+	in.logger.Info("loading", "stage", stageCredits, "file", path)
+
+	r, err := openTSV(path, "tconst", "ordering", "nconst", "category", "job", "characters")
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return withTx(ctx, in.db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("ingest_title_principals", "tconst", "ordering", "nconst", "category", "job", "characters"))
+		if err != nil {
+			return err
+		}
+
+		for r.Next() {
+			ordering, err := strconv.Atoi(r.Get("ordering"))
+			if err != nil || validator.In(r.Get("category"), skippedCategories...) {
+				cp.Skipped++
+				continue
+			}
+
+			characters := []string{}
+			if s := r.Get("characters"); s != "" {
+				if err := json.Unmarshal([]byte(s), &characters); err != nil {
+					characters = []string{s}
+				}
+			}
+
+			_, err = stmt.ExecContext(ctx, r.Get("tconst"), ordering, r.Get("nconst"), r.Get("category"), r.Get("job"), pq.Array(characters))
+			if err != nil {
+				return err
+			}
+		}
+		if err := r.Err(); err != nil {
+			return err
+		}
+
+		if _, err := stmt.ExecContext(ctx); err != nil {
+			return err
+		}
+		if err := stmt.Close(); err != nil {
+			return err
+		}
+
+		cp.Loaded = true
+		return in.saveCheckpoint(ctx, tx, cp)
+	})
+}
+
+// mergeCredits replaces the credits of the movies in the next chunk of staged
+// titles. Principals of titles missing from the catalogue are skipped.
+func (in *ingester) mergeCredits(ctx context.Context, cp *checkpoint) (bool, error) {
+	done := false
+
+	err := withTx(ctx, in.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `CREATE TEMP TABLE ingest_credit_movies ON COMMIT DROP AS
+		SELECT t.tconst, e.movie_id
+		FROM (SELECT DISTINCT tconst FROM ingest_title_principals WHERE tconst > $1 ORDER BY tconst LIMIT $2) t
+		LEFT JOIN external_ids e ON e.provider = 'imdb' AND e.value = t.tconst`, cp.LastKey, in.config.chunkSize)
+		if err != nil {
+			return err
+		}
+
+		var lastKey sql.NullString
+		var skipped int64
+		err = tx.QueryRowContext(ctx, `SELECT (SELECT max(tconst) FROM ingest_credit_movies), count(*)
+		FROM ingest_title_principals p
+		INNER JOIN ingest_credit_movies m ON m.tconst = p.tconst
+		WHERE m.movie_id IS NULL`).Scan(&lastKey, &skipped)
+		if err != nil {
+			return err
+		}
+		if !lastKey.Valid {
+			done = true
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO people (imdb_id, name)
+		SELECT DISTINCT p.nconst, COALESCE(n.name, '')
+		FROM ingest_title_principals p
+		INNER JOIN ingest_credit_movies m ON m.tconst = p.tconst AND m.movie_id IS NOT NULL
+		LEFT JOIN ingest_name_basics n ON n.nconst = p.nconst
+		ON CONFLICT (imdb_id) DO UPDATE SET name = EXCLUDED.name
+		WHERE EXCLUDED.name <> '' AND people.name <> EXCLUDED.name`)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `DELETE FROM movie_credits WHERE movie_id IN (SELECT movie_id FROM ingest_credit_movies)`)
+		if err != nil {
+			return err
+		}
+		replaced, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		result, err = tx.ExecContext(ctx, `INSERT INTO movie_credits (movie_id, person_id, category, job, characters, ordering)
+		SELECT m.movie_id, people.id, p.category, p.job, p.characters, p.ordering
+		FROM ingest_title_principals p
+		INNER JOIN ingest_credit_movies m ON m.tconst = p.tconst AND m.movie_id IS NOT NULL
+		INNER JOIN people ON people.imdb_id = p.nconst`)
+		if err != nil {
+			return err
+		}
+		written, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		cp.LastKey = lastKey.String
+		cp.Inserted += written - min(written, replaced)
+		cp.Updated += min(written, replaced)
+		cp.Skipped += skipped
+		return in.saveCheckpoint(ctx, tx, cp)
+	})
+	if err == nil && !done {
+		in.logger.Info("merged", "stage", stageCredits, "last", cp.LastKey, "inserted", cp.Inserted, "updated", cp.Updated)
+	}
+	return done, err
+}
@@ -0,0 +1,115 @@
+// Command ingest seeds and refreshes the catalogue from the IMDb TSV dumps.
+//
+// The dumps are first copied into staging tables, then merged into the
+// catalogue in chunks. Every step is recorded in ingest_checkpoints, so an
+// interrupted run picks up where it stopped when started again with the same
+// files, and a new download of a file starts that file over.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+type config struct {
+	dsn        string
+	basics     string
+	principals string
+	names      string
+	types      []string
+	chunkSize  int
+	restart    bool
+}
+
+type ingester struct {
+	db     *sql.DB
+	logger *slog.Logger
+	config config
+}
+
+func main() {
+	// the .env file is optional here, the DSN can also come from the flag
+	_ = godotenv.Load()
+
+	var cfg config
+	var types string
+
+	flag.StringVar(&cfg.dsn, "dsn", os.Getenv("DSN"), "PostgreSQL DSN")
+	flag.StringVar(&cfg.basics, "basics", "", "Path to title.basics.tsv(.gz)")
+	flag.StringVar(&cfg.principals, "principals", "", "Path to title.principals.tsv(.gz), optional")
+	flag.StringVar(&cfg.names, "names", "", "Path to name.basics.tsv(.gz) to name the people in the credits, optional")
+	flag.StringVar(&types, "types", "movie,tvMovie", "Comma separated IMDb title types to ingest")
+	flag.IntVar(&cfg.chunkSize, "chunk", 5000, "Number of titles merged per transaction")
+	flag.BoolVar(&cfg.restart, "restart", false, "Ignore checkpoints and start every file over")
+	flag.Parse()
+
+	cfg.types = strings.Split(types, ",")
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	if cfg.basics == "" && cfg.principals == "" {
+		fmt.Fprintln(os.Stderr, "at least one of -basics or -principals must be provided")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := sql.Open("postgres", cfg.dsn)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	in := &ingester{db: db, logger: logger, config: cfg}
+
+	start := time.Now()
+	if err := in.run(ctx); err != nil {
+		logger.Error("ingest stopped, run the command again to resume", "err", err.Error())
+		os.Exit(1)
+	}
+	logger.Info("ingest completed", "duration", time.Since(start).Round(time.Second).String())
+}
+
+func (in *ingester) run(ctx context.Context) error {
+	if in.config.basics != "" {
+		report, err := in.ingestTitles(ctx, in.config.basics)
+		if err != nil {
+			return err
+		}
+		in.report(stageTitles, report)
+	}
+
+	if in.config.principals != "" {
+		if in.config.names != "" {
+			report, err := in.ingestNames(ctx, in.config.names)
+			if err != nil {
+				return err
+			}
+			in.report(stageNames, report)
+		}
+
+		report, err := in.ingestCredits(ctx, in.config.principals)
+		if err != nil {
+			return err
+		}
+		in.report(stageCredits, report)
+	}
+	return nil
+}
+
+func (in *ingester) report(stage string, cp *checkpoint) {
+	in.logger.Info(stage, "inserted", cp.Inserted, "updated", cp.Updated, "skipped", cp.Skipped)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"movies/internal/validator"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// genreNames maps IMDb genres onto the catalogue genres. Genres mapped to an
+// empty string describe formats rather than genres and are dropped.
+var genreNames = map[string]string{
+	"Sci-Fi":     "Science Fiction",
+	"Film-Noir":  "Film Noir",
+	"Adult":      "",
+	"Game-Show":  "",
+	"News":       "",
+	"Reality-TV": "",
+	"Short":      "",
+	"Talk-Show":  "",
+}
+
+func mapGenres(s string) []string {
+	genres := []string{}
+	for _, genre := range strings.Split(s, ",") {
+		if name, ok := genreNames[genre]; ok {
+			genre = name
+		}
+		if genre != "" && !validator.In(genre, genres...) {
+			genres = append(genres, genre)
+		}
+	}
+	return genres
+}
+
+func (in *ingester) ingestTitles(ctx context.Context, path string) (*checkpoint, error) {
+	cp, err := in.openCheckpoint(ctx, stageTitles, path)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Completed {
+		in.logger.Info("already ingested, skipping", "stage", stageTitles)
+		return cp, nil
+	}
+
+	if !cp.Loaded {
+		err := in.loadTitles(ctx, path, cp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		done, err := in.mergeTitles(ctx, cp)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+
+	cp.Completed = true
+	return cp, in.saveCheckpoint(ctx, in.db, cp)
+}
+
+// loadTitles copies the titles worth ingesting into the staging table. Titles
+// of other types, adult titles and titles missing what a movie requires are
+// counted as skipped.
+func (in *ingester) loadTitles(ctx context.Context, path string, cp *checkpoint) error {
+	in.logger.Info("loading", "stage", stageTitles, "file", path)
+
+	r, err := openTSV(path, "tconst", "titleType", "primaryTitle", "isAdult", "startYear", "runtimeMinutes", "genres")
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return withTx(ctx, in.db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("ingest_title_basics", "tconst", "title", "year", "runtime", "genres"))
+		if err != nil {
+			return err
+		}
+
+		// the same bounds ValidateMovie applies, a movie outside them couldn't
+		// be edited afterwards
+		maxYear := time.Now().Year() + 10
+
+		loaded := 0
+		for r.Next() {
+			if !validator.In(r.Get("titleType"), in.config.types...) || r.Get("isAdult") == "1" {
+				cp.Skipped++
+				continue
+			}
+
+			title := r.Get("primaryTitle")
+			year, yearErr := strconv.Atoi(r.Get("startYear"))
+			runtime, runtimeErr := strconv.Atoi(r.Get("runtimeMinutes"))
+			genres := mapGenres(r.Get("genres"))
+
+			if title == "" || len(title) > 500 || yearErr != nil || year < 1888 || year > maxYear || runtimeErr != nil || runtime <= 0 || len(genres) == 0 {
+				cp.Skipped++
+				continue
+			}
+
+			_, err := stmt.ExecContext(ctx, r.Get("tconst"), title, year, runtime, pq.Array(genres))
+			if err != nil {
+				return err
+			}
+
+			loaded++
+			if loaded%500000 == 0 {
+				in.logger.Info("loading", "stage", stageTitles, "rows", loaded)
+			}
+		}
+		if err := r.Err(); err != nil {
+			return err
+		}
+
+		if _, err := stmt.ExecContext(ctx); err != nil {
+			return err
+		}
+		if err := stmt.Close(); err != nil {
+			return err
+		}
+
+		cp.Loaded = true
+		return in.saveCheckpoint(ctx, tx, cp)
+	})
+}
+
+// mergeTitles upserts the next chunk of staged titles by their IMDb id and
+// records a revision for every movie created or changed, moving the checkpoint
+// in the same transaction. Titles that belong to a movie in the trash, or that
+// match their movie already, are skipped.
+func (in *ingester) mergeTitles(ctx context.Context, cp *checkpoint) (bool, error) {
+	done := false
+
+	err := withTx(ctx, in.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `CREATE TEMP TABLE ingest_chunk ON COMMIT DROP AS
+		SELECT s.tconst, s.title, s.year, s.runtime, s.genres, e.movie_id, COALESCE(m.deleted_at IS NOT NULL, false) AS trashed
+		FROM ingest_title_basics s
+		LEFT JOIN external_ids e ON e.provider = 'imdb' AND e.value = s.tconst
+		LEFT JOIN movies m ON m.id = e.movie_id
+		WHERE s.tconst > $1
+		ORDER BY s.tconst
+		LIMIT $2`, cp.LastKey, in.config.chunkSize)
+		if err != nil {
+			return err
+		}
+
+		var lastKey sql.NullString
+		var matched, trashed int64
+		err = tx.QueryRowContext(ctx, `SELECT max(tconst), count(movie_id), count(*) FILTER (WHERE trashed) FROM ingest_chunk`).Scan(&lastKey, &matched, &trashed)
+		if err != nil {
+			return err
+		}
+		if !lastKey.Valid {
+			done = true
+			return nil
+		}
+
+		rows, err := tx.QueryContext(ctx, `UPDATE movies m
+		SET title = c.title, year = c.year, runtime = c.runtime, genres = c.genres, version = m.version + 1
+		FROM ingest_chunk c
+		WHERE m.id = c.movie_id AND NOT c.trashed
+		AND (m.title, m.year, m.runtime, m.genres) IS DISTINCT FROM (c.title, c.year, c.runtime, c.genres)
+		RETURNING m.id`)
+		if err != nil {
+			return err
+		}
+		var updated []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			updated = append(updated, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO movie_revisions (movie_id, version, action, snapshot)
+		SELECT id, version, 'update', movie_snapshot(id) FROM movies WHERE id = ANY($1)`, pq.Array(updated))
+		if err != nil {
+			return err
+		}
+
+		// Ids are taken up front so the new movies can be matched with their
+		// IMDb ids without a round trip per movie.
+		result, err := tx.ExecContext(ctx, `CREATE TEMP TABLE ingest_new ON COMMIT DROP AS
+		SELECT nextval(pg_get_serial_sequence('movies', 'id')) AS id, tconst, title, year, runtime, genres
+		FROM ingest_chunk
+		WHERE movie_id IS NULL`)
+		if err != nil {
+			return err
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		statements := []string{
+			`INSERT INTO movies (id, title, year, runtime, genres) SELECT id, title, year, runtime, genres FROM ingest_new`,
+			`INSERT INTO external_ids (movie_id, provider, value) SELECT id, 'imdb', tconst FROM ingest_new`,
+			`INSERT INTO movie_revisions (movie_id, version, action, snapshot) SELECT id, 1, 'create', movie_snapshot(id) FROM ingest_new`,
+		}
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+
+		cp.LastKey = lastKey.String
+		cp.Inserted += inserted
+		cp.Updated += int64(len(updated))
+		cp.Skipped += matched - int64(len(updated))
+		return in.saveCheckpoint(ctx, tx, cp)
+	})
+	if err == nil && !done {
+		in.logger.Info("merged", "stage", stageTitles, "last", cp.LastKey, "inserted", cp.Inserted, "updated", cp.Updated)
+	}
+	return done, err
+}
+
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// tsvReader reads the IMDb dumps: tab separated, no quoting, \N for missing
+// values and a header line naming the columns.
+type tsvReader struct {
+	file    *os.File
+	gz      *gzip.Reader
+	scanner *bufio.Scanner
+	columns map[string]int
+	record  []string
+}
+
+func openTSV(path string, required ...string) (*tsvReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &tsvReader{file: file}
+
+	var src io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		r.gz, err = gzip.NewReader(bufio.NewReaderSize(file, 1<<20))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		src = r.gz
+	}
+
+	r.scanner = bufio.NewScanner(bufio.NewReaderSize(src, 1<<20))
+	r.scanner.Buffer(make([]byte, 64*1024), 4<<20)
+
+	if !r.scanner.Scan() {
+		r.Close()
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	r.columns = make(map[string]int)
+	for i, name := range strings.Split(r.scanner.Text(), "\t") {
+		r.columns[name] = i
+	}
+	for _, name := range required {
+		if _, ok := r.columns[name]; !ok {
+			r.Close()
+			return nil, fmt.Errorf("%s has no %s column", path, name)
+		}
+	}
+	return r, nil
+}
+
+func (r *tsvReader) Next() bool {
+	if !r.scanner.Scan() {
+		return false
+	}
+	r.record = strings.Split(r.scanner.Text(), "\t")
+	return true
+}
+
+// Get returns the value of a column of the current record, or an empty string
+// when the value is missing.
+func (r *tsvReader) Get(column string) string {
+	i := r.columns[column]
+	if i >= len(r.record) || r.record[i] == `\N` {
+		return ""
+	}
+	return r.record[i]
+}
+
+func (r *tsvReader) Err() error {
+	return r.scanner.Err()
+}
+
+func (r *tsvReader) Close() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+var errBatchFailed = errors.New("batch failed")
+
+// BatchOperation is one write of a batch. Updates carry the movie with the
+// version it is expected to have, deletes may carry one in Version. Err is set
+// when the operation fails.
+type BatchOperation struct {
+	Op      string
+	ID      int
+	Version *int32
+	Movie   *Movie
+	Err     error
+	Done    bool
+}
+
+// Batch runs the operations in order in a single transaction. In atomic mode
+// the first failing operation rolls back the whole batch, otherwise every
+// operation runs in its own savepoint and only the failing ones are undone.
+// Operations that already carry an error are left out. Errors that belong to
+// an operation are reported on it, Batch itself only fails on unexpected
+// errors.
+func (m *MovieModel) Batch(ops []*BatchOperation, atomic bool, editorID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	defer cancel()
+
+	if atomic {
+		for _, op := range ops {
+			if op.Err != nil {
+				return nil
+			}
+		}
+	}
+
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		for _, op := range ops {
+			if op.Err != nil {
+				continue
+			}
+
+			if !atomic {
+				if _, err := tx.ExecContext(ctx, `SAVEPOINT batch_operation`); err != nil {
+					return err
+				}
+			}
+
+			err := runBatchOperation(ctx, tx, op, editorID)
+			switch {
+			case err == nil:
+				op.Done = true
+				if !atomic {
+					if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT batch_operation`); err != nil {
+						return err
+					}
+				}
+			case errors.Is(err, ErrNoRecordFound), errors.Is(err, ErrEditConflict),
+				errors.Is(err, ErrDuplicateExternalID), errors.Is(err, ErrTrashedExternalID):
+				op.Err = err
+				if atomic {
+					return errBatchFailed
+				}
+				if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT batch_operation`); err != nil {
+					return err
+				}
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchFailed) {
+		for _, op := range ops {
+			op.Done = false
+		}
+		return nil
+	}
+	return err
+}
+
+func runBatchOperation(ctx context.Context, tx *sql.Tx, op *BatchOperation, editorID int) error {
+	switch op.Op {
+	case BatchCreate:
+		return insertMovie(ctx, tx, op.Movie, editorID)
+	case BatchUpdate:
+		return updateMovie(ctx, tx, op.Movie, editorID, RevisionUpdate, nil)
+	case BatchDelete:
+		return deleteMovie(ctx, tx, op.ID, op.Version, editorID)
+	default:
+		return errors.New("unknown batch operation " + op.Op)
+	}
+}
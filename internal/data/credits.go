@@ -0,0 +1,54 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Credit struct {
+	PersonID   int            `json:"person_id"`
+	Name       string         `json:"name"`
+	Category   string         `json:"category"`
+	Job        string         `json:"job,omitempty"`
+	Characters pq.StringArray `json:"characters,omitempty"`
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+func (m CreditModel) GetForMovies(movieIDs []int) (map[int][]*Credit, error) {
+	query := `SELECT c.movie_id, p.id, p.name, c.category, c.job, c.characters
+	FROM movie_credits c
+	INNER JOIN people p ON p.id = c.person_id
+	WHERE c.movie_id = ANY($1)
+	ORDER BY c.movie_id, c.ordering, c.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[int][]*Credit)
+
+	for rows.Next() {
+		var movieID int
+		var c Credit
+		err := rows.Scan(&movieID, &c.PersonID, &c.Name, &c.Category, &c.Job, &c.Characters)
+		if err != nil {
+			return nil, err
+		}
+		credits[movieID] = append(credits[movieID], &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return credits, nil
+}
@@ -0,0 +1,327 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"movies/internal/validator"
+	"time"
+)
+
+const (
+	MergeTarget = "target"
+	MergeSource = "source"
+	MergeUnion  = "union"
+)
+
+var (
+	mergeScalarFields     = []string{"title", "year", "runtime"}
+	mergeCollectionFields = []string{"genres", "localizations", "releases", "certifications", "external_ids"}
+)
+
+// mergedTables lists the tables holding rows that belong to a movie and are
+// moved onto the surviving movie when two movies are merged.
+var mergedTables = []string{"movie_images", "movie_videos", "movie_credits"}
+
+// mergedUserTables lists the tables holding at most one row per user and
+// movie. The rows of the source are moved unless the user already has one for
+// the target, which wins.
+var mergedUserTables = []string{"movie_ratings", "watchlist_items"}
+
+type DuplicateMovie struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Year    int32  `json:"year"`
+	Runtime int32  `json:"runtime"`
+}
+
+type DuplicateCandidate struct {
+	Movies          [2]DuplicateMovie `json:"movies"`
+	TitleSimilarity float64           `json:"title_similarity"`
+	Score           float64           `json:"score"`
+}
+
+// MergeRules tells for every field which movie the merged value is taken from.
+// Collections can also be combined, the target winning where both movies hold
+// an entry for the same language, country, system or provider.
+type MergeRules map[string]string
+
+func DefaultMergeRules() MergeRules {
+	rules := MergeRules{}
+	for _, field := range mergeScalarFields {
+		rules[field] = MergeTarget
+	}
+	for _, field := range mergeCollectionFields {
+		rules[field] = MergeUnion
+	}
+	return rules
+}
+
+func ValidateMergeRules(v *validator.Validator, rules MergeRules) {
+	for field, rule := range rules {
+		switch {
+		case validator.In(field, mergeScalarFields...):
+			v.Check(validator.In(rule, MergeTarget, MergeSource), "rules", validator.CodeNotAllowed, fmt.Sprintf("%s must be merged with target or source", field))
+		case validator.In(field, mergeCollectionFields...):
+			v.Check(validator.In(rule, MergeTarget, MergeSource, MergeUnion), "rules", validator.CodeNotAllowed, fmt.Sprintf("%s must be merged with target, source or union", field))
+		default:
+			v.AddError("rules", validator.CodeNotAllowed, fmt.Sprintf("%s cannot be merged", field))
+		}
+	}
+}
+
+// MergeMovies combines two complete movies, as found in revision snapshots,
+// into the state the target should have once the source is merged into it.
+func MergeMovies(target, source *Movie, rules MergeRules) *Movie {
+	merged := *target
+
+	pick := func(field string) *Movie {
+		if rules[field] == MergeSource {
+			return source
+		}
+		return target
+	}
+
+	merged.Title = pick("title").Title
+	merged.Year = pick("year").Year
+	merged.Runtime = pick("runtime").Runtime
+
+	switch rules["genres"] {
+	case MergeUnion:
+		merged.Genres = append([]string{}, target.Genres...)
+		for _, genre := range source.Genres {
+			if !validator.In(genre, merged.Genres...) {
+				merged.Genres = append(merged.Genres, genre)
+			}
+		}
+	default:
+		merged.Genres = pick("genres").Genres
+	}
+
+	switch rules["localizations"] {
+	case MergeUnion:
+		merged.Localizations = []*Localization{}
+		languages := map[string]bool{}
+		hasOriginal := false
+		for _, l := range append(append([]*Localization{}, target.Localizations...), source.Localizations...) {
+			if languages[l.Language] {
+				continue
+			}
+			languages[l.Language] = true
+			copied := *l
+			copied.IsOriginal = l.IsOriginal && !hasOriginal
+			hasOriginal = hasOriginal || copied.IsOriginal
+			merged.Localizations = append(merged.Localizations, &copied)
+		}
+	default:
+		merged.Localizations = pick("localizations").Localizations
+	}
+
+	switch rules["releases"] {
+	case MergeUnion:
+		merged.Releases = []*Release{}
+		seen := map[string]bool{}
+		for _, r := range append(append([]*Release{}, target.Releases...), source.Releases...) {
+			if !seen[r.Country+"/"+r.Type] {
+				seen[r.Country+"/"+r.Type] = true
+				merged.Releases = append(merged.Releases, r)
+			}
+		}
+	default:
+		merged.Releases = pick("releases").Releases
+	}
+
+	switch rules["certifications"] {
+	case MergeUnion:
+		merged.Certifications = []*Certification{}
+		seen := map[string]bool{}
+		for _, c := range append(append([]*Certification{}, target.Certifications...), source.Certifications...) {
+			if !seen[c.System] {
+				seen[c.System] = true
+				merged.Certifications = append(merged.Certifications, c)
+			}
+		}
+	default:
+		merged.Certifications = pick("certifications").Certifications
+	}
+
+	switch rules["external_ids"] {
+	case MergeUnion:
+		merged.ExternalIDs = map[string]string{}
+		for provider, value := range source.ExternalIDs {
+			merged.ExternalIDs[provider] = value
+		}
+		for provider, value := range target.ExternalIDs {
+			merged.ExternalIDs[provider] = value
+		}
+	default:
+		merged.ExternalIDs = pick("external_ids").ExternalIDs
+	}
+
+	if merged.Localizations == nil {
+		merged.Localizations = []*Localization{}
+	}
+	if merged.Releases == nil {
+		merged.Releases = []*Release{}
+	}
+	if merged.Certifications == nil {
+		merged.Certifications = []*Certification{}
+	}
+	if merged.ExternalIDs == nil {
+		merged.ExternalIDs = map[string]string{}
+	}
+	return &merged
+}
+
+// FindDuplicates scores pairs of movies with similar normalised titles. Titles
+// weigh the most, followed by the distance between the years and the runtimes.
+func (m *MovieModel) FindDuplicates(minScore float64, filters Filter) ([]*DuplicateCandidate, MetaData, error) {
+	offset := (filters.Page - 1) * filters.PageSize
+
+	query := `SELECT COUNT(*) OVER(), * FROM (
+		SELECT a.id AS a_id, a.title, a.year, a.runtime, b.id AS b_id, b.title, b.year, b.runtime,
+		similarity(a.title_normalized, b.title_normalized) AS title_similarity,
+		0.6 * similarity(a.title_normalized, b.title_normalized)
+		+ 0.25 * GREATEST(0, 1 - abs(a.year - b.year) / 2.0)
+		+ 0.15 * GREATEST(0, 1 - abs(a.runtime - b.runtime) / 15.0) AS score
+		FROM movies a
+		INNER JOIN movies b ON a.id < b.id AND a.title_normalized % b.title_normalized
+		WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+	) candidates
+	WHERE score >= $1
+	ORDER BY score DESC, a_id, b_id
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, minScore, filters.PageSize, offset)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	candidates := []*DuplicateCandidate{}
+
+	for rows.Next() {
+		var candidate DuplicateCandidate
+		a, b := &candidate.Movies[0], &candidate.Movies[1]
+		err := rows.Scan(
+			&totalRecords,
+			&a.ID, &a.Title, &a.Year, &a.Runtime,
+			&b.ID, &b.Title, &b.Year, &b.Runtime,
+			&candidate.TitleSimilarity,
+			&candidate.Score,
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+		candidates = append(candidates, &candidate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+	return candidates, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Merge folds the source movie into the target. The target is updated to the
+// merged state, everything attached to the source is moved onto it, and the
+// source is removed leaving a redirect behind. Both movies carry the version
+// they are expected to have.
+func (m *MovieModel) Merge(target *Movie, source *Movie, editorID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE movies SET version = version + 1 WHERE id = $1 AND version = $2 AND deleted_at IS NULL`, source.ID, source.Version)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrEditConflict
+		}
+
+		err = insertRevision(ctx, tx, source.ID, RevisionMerge, editorID, nil)
+		if err != nil {
+			return err
+		}
+
+		// The source gives up its external ids first so the target can take them.
+		_, err = tx.ExecContext(ctx, `DELETE FROM external_ids WHERE movie_id = $1`, source.ID)
+		if err != nil {
+			return err
+		}
+
+		err = updateMovie(ctx, tx, target, editorID, RevisionMerge, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, table := range mergedTables {
+			_, err := tx.ExecContext(ctx, `UPDATE `+table+` SET movie_id = $1 WHERE movie_id = $2`, target.ID, source.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, table := range mergedUserTables {
+			_, err := tx.ExecContext(ctx, `UPDATE `+table+` SET movie_id = $1
+			WHERE movie_id = $2 AND user_id NOT IN (SELECT user_id FROM `+table+` WHERE movie_id = $1)`, target.ID, source.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Views of the source add up to the views of the target in the same hour.
+		_, err = tx.ExecContext(ctx, `INSERT INTO movie_views (movie_id, bucket, views, impressions)
+		SELECT $1, bucket, views, impressions FROM movie_views WHERE movie_id = $2
+		ON CONFLICT (movie_id, bucket) DO UPDATE
+		SET views = movie_views.views + EXCLUDED.views, impressions = movie_views.impressions + EXCLUDED.impressions`, target.ID, source.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE movie_redirects SET to_id = $1 WHERE to_id = $2`, target.ID, source.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO movie_redirects (from_id, to_id) VALUES ($1, $2)`, source.ID, target.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM movies WHERE id = $1`, source.ID)
+		return err
+	})
+}
+
+// GetRedirect returns the id of the movie that a merged movie now lives at.
+func (m *MovieModel) GetRedirect(id int) (int, error) {
+	query := `SELECT to_id FROM movie_redirects WHERE from_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	var to int
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&to)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNoRecordFound
+		default:
+			return 0, err
+		}
+	}
+	return to, nil
+}
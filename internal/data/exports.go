@@ -0,0 +1,74 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+const exportFetchSize = 500
+
+// Export streams every movie matching the search to fn, in the order given by
+// the filters. Rows are read through a server-side cursor inside a read-only
+// snapshot, so the export is consistent and memory use doesn't grow with the
+// size of the catalogue. The context bounds the whole export.
+func (m *MovieModel) Export(ctx context.Context, search MovieSearch, filters Filter, fn func(*Movie) error) error {
+	query := fmt.Sprintf(`DECLARE movies_export NO SCROLL CURSOR FOR
+	SELECT id, created_at, title, year, runtime, genres, version,
+	COALESCE((SELECT jsonb_object_agg(e.provider, e.value) FROM external_ids e WHERE e.movie_id = movies.id), '{}')
+	FROM movies
+	WHERE %s
+	ORDER BY %s %s, id ASC`, movieSearchConditions, filters.sortColumn(), filters.sortDirection())
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query, search.args()...)
+	if err != nil {
+		return err
+	}
+
+	for {
+		n, err := fetchExport(ctx, tx, fn)
+		if err != nil {
+			return err
+		}
+		if n < exportFetchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+func fetchExport(ctx context.Context, tx *sql.Tx, fn func(*Movie) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`FETCH FORWARD %d FROM movies_export`, exportFetchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var movie Movie
+		var externalIDs []byte
+
+		err := rows.Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, &movie.Genres, &movie.Version, &externalIDs)
+		if err != nil {
+			return n, err
+		}
+		if err := json.Unmarshal(externalIDs, &movie.ExternalIDs); err != nil {
+			return n, err
+		}
+
+		if err := fn(&movie); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
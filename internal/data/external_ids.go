@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"movies/internal/validator"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateExternalID = errors.New("duplicate external id")
+	ErrTrashedExternalID   = errors.New("external id belongs to a movie in the trash")
+)
+
+func ValidateExternalIDs(v *validator.Validator, externalIDs map[string]string) {
+	for provider, value := range externalIDs {
+		_, known := validator.ExternalIDProviders[provider]
+		v.Check(known, "external_ids", validator.CodeNotAllowed, "provider must be one of imdb, tmdb or wikidata")
+		v.Check(!known || validator.ExternalID(provider, value), "external_ids", validator.CodeInvalid, provider+" id is not in a valid format")
+	}
+}
+
+type ExternalIDModel struct {
+	DB *sql.DB
+}
+
+func (m ExternalIDModel) GetMovieID(provider, value string) (int, error) {
+	query := `SELECT movie_id FROM external_ids WHERE provider = $1 AND value = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movieID int
+
+	err := m.DB.QueryRowContext(ctx, query, provider, value).Scan(&movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNoRecordFound
+		default:
+			return 0, err
+		}
+	}
+	return movieID, nil
+}
+
+func (m ExternalIDModel) GetForMovies(movieIDs []int) (map[int]map[string]string, error) {
+	query := `SELECT movie_id, provider, value FROM external_ids WHERE movie_id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	externalIDs := make(map[int]map[string]string)
+
+	for rows.Next() {
+		var movieID int
+		var provider, value string
+		err := rows.Scan(&movieID, &provider, &value)
+		if err != nil {
+			return nil, err
+		}
+		if externalIDs[movieID] == nil {
+			externalIDs[movieID] = make(map[string]string)
+		}
+		externalIDs[movieID][provider] = value
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return externalIDs, nil
+}
+
+func replaceExternalIDs(ctx context.Context, tx *sql.Tx, movieID int, externalIDs map[string]string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM external_ids WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	// Movies in the trash keep their external ids so they can be restored as they
+	// were; report those conflicts separately since the fix is a restore or purge.
+	conflictQuery := `SELECT movies.deleted_at IS NOT NULL
+	FROM external_ids
+	INNER JOIN movies ON movies.id = external_ids.movie_id
+	WHERE external_ids.provider = $1 AND external_ids.value = $2 AND external_ids.movie_id <> $3`
+
+	query := `INSERT INTO external_ids (movie_id, provider, value) VALUES ($1, $2, $3)`
+
+	for provider, value := range externalIDs {
+		var trashed bool
+		err := tx.QueryRowContext(ctx, conflictQuery, provider, value, movieID).Scan(&trashed)
+		switch {
+		case err == nil && trashed:
+			return ErrTrashedExternalID
+		case err == nil:
+			return ErrDuplicateExternalID
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, query, movieID, provider, value)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "external_ids_provider_value_key"`:
+				return ErrDuplicateExternalID
+			default:
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	FacetGenres        = "genres"
+	FacetDecade        = "decade"
+	FacetRuntimeBucket = "runtime_bucket"
+)
+
+var MovieFacets = []string{FacetGenres, FacetDecade, FacetRuntimeBucket}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// facetQueries count the values of every facet. Each one applies the whole
+// search except the facet's own filter, so picking a value doesn't hide the
+// other values of the same facet. The genres facet thus counts every genre of
+// the movies passing the other filters, whatever genres are selected.
+var facetQueries = map[string]string{
+	FacetGenres: `SELECT 'genres', genre, COUNT(*) FROM matching, unnest(genres) AS genre
+	WHERE year_ok AND runtime_ok GROUP BY genre`,
+	FacetDecade: `SELECT 'decade', (year / 10 * 10)::text || 's', COUNT(*) FROM matching
+	WHERE genres_ok AND runtime_ok GROUP BY year / 10`,
+	FacetRuntimeBucket: `SELECT 'runtime_bucket', CASE
+		WHEN runtime < 90 THEN '0-89'
+		WHEN runtime < 120 THEN '90-119'
+		WHEN runtime < 150 THEN '120-149'
+		ELSE '150+' END, COUNT(*) FROM matching
+	WHERE genres_ok AND year_ok GROUP BY 2`,
+}
+
+// Facets returns the number of movies matching the search for every value of
+// the given facets, most frequent values first.
+func (m *MovieModel) Facets(search MovieSearch, facets []string) (map[string][]*FacetCount, error) {
+	counts := make(map[string][]*FacetCount, len(facets))
+	if len(facets) == 0 {
+		return counts, nil
+	}
+
+	parts := make([]string, 0, len(facets))
+	for _, facet := range facets {
+		query, ok := facetQueries[facet]
+		if !ok {
+			panic("unknown facet: " + facet)
+		}
+		parts = append(parts, query)
+		counts[facet] = []*FacetCount{}
+	}
+
+	query := fmt.Sprintf(`WITH matching AS (
+		SELECT genres, year, runtime,
+		%s AS genres_ok,
+		%s AS year_ok,
+		%s AS runtime_ok
+		FROM movies
+		WHERE %s
+	)
+	SELECT * FROM (%s) facets
+	ORDER BY 1, 3 DESC, 2`, movieGenresCondition, movieYearCondition, movieRuntimeCondition, movieBaseConditions, strings.Join(parts, "\n\tUNION ALL\n\t"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var facet string
+		var count FacetCount
+		err := rows.Scan(&facet, &count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts[facet] = append(counts[facet], &count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
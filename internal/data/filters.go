@@ -1,8 +1,10 @@
 package data
 
 import (
+	"fmt"
 	"math"
 	"movies/internal/validator"
+	"strconv"
 	"strings"
 )
 
@@ -11,6 +13,21 @@ type Filter struct {
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	// After and Before switch to keyset pagination, returning the rows that
+	// come after or before the row the cursor was made for.
+	After  *Cursor
+	Before *Cursor
+	// IncludeTotal counts the matching rows when paginating with a cursor,
+	// offset pagination always counts them.
+	IncludeTotal bool
+}
+
+// Cursor points at a row of a listing by the value of its sort column and its
+// id, which breaks ties.
+type Cursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   int    `json:"i"`
 }
 
 type MetaData struct {
@@ -19,13 +36,39 @@ type MetaData struct {
 	FirstPage    int `json:"first_page,omitempty"`
 	LastPage     int `json:"last_page,omitempty"`
 	TotalRecords int `json:"total_records,omitempty"`
+	// Next and Prev link to the neighbouring pages of a keyset pagination,
+	// they are filled in from NextCursor and PrevCursor.
+	Next       string  `json:"next,omitempty"`
+	Prev       string  `json:"prev,omitempty"`
+	NextCursor *Cursor `json:"-"`
+	PrevCursor *Cursor `json:"-"`
 }
 
 func ValidateFilters(v *validator.Validator, filter *Filter) {
 	// title validation
-	v.Check(filter.Page >= 1 && filter.PageSize <= 10_000_000, "page", "page must be between 1 and 10000000")
-	v.Check(filter.PageSize >= 1 && filter.PageSize <= 100, "page_size", "page size must be between 1 and 100")
-	v.Check(validator.In(filter.Sort, filter.SortSafeList...), "page_size", "invalid sort value")
+	v.Check(filter.Page >= 1 && filter.Page <= 10_000_000, "page", validator.CodeOutOfRange, "page must be between 1 and 10000000")
+	v.Check(filter.PageSize >= 1 && filter.PageSize <= 100, "page_size", validator.CodeOutOfRange, "page size must be between 1 and 100")
+	v.Check(validator.In(filter.Sort, filter.SortSafeList...), "sort", validator.CodeNotAllowed, "invalid sort value")
+
+	// cursor validation
+	v.Check(filter.After == nil || filter.Before == nil, "after", validator.CodeNotAllowed, "after and before can't be used together")
+	v.Check(filter.Page == 1 || (filter.After == nil && filter.Before == nil), "page", validator.CodeNotAllowed, "page can't be used together with a cursor")
+	for _, cursor := range []*Cursor{filter.After, filter.Before} {
+		v.Check(cursor == nil || cursor.Sort == filter.Sort, "sort", validator.CodeInvalid, "the cursor was made for another sort")
+	}
+}
+
+// ValidateFields checks that every value of a list parameter such as fields
+// or include is in the safe list.
+func ValidateFields(v *validator.Validator, key string, values []string, safeList []string) {
+	for _, value := range values {
+		v.Check(validator.In(value, safeList...), key, validator.CodeNotAllowed, fmt.Sprintf("unknown %s value %q, must be one of %s", key, value, strings.Join(safeList, ", ")))
+	}
+	v.Check(validator.Unique(values), key, validator.CodeNotUnique, key+" must contain unique values")
+}
+
+func (f Filter) keyset() bool {
+	return f.After != nil || f.Before != nil
 }
 
 func (f Filter) sortColumn() string {
@@ -37,13 +80,60 @@ func (f Filter) sortColumn() string {
 	panic("unsafe sort parameter: " + f.Sort)
 }
 
+// descendingSorts read best from the highest value down, so they are sorted
+// in descending order unless prefixed with "-".
+var descendingSorts = map[string]bool{"relevance": true, "popularity": true}
+
 func (f Filter) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
+	if strings.HasPrefix(f.Sort, "-") != descendingSorts[f.sortColumn()] {
 		return "DESC"
 	}
 	return "ASC"
 }
 
+// keysetConditions returns the condition selecting the rows after or before
+// the cursor of the filter and the ORDER BY to read them in. The column is
+// the SQL the rows are sorted by, the cursor key and id are taken as the given
+// placeholders. Rows before a cursor are read in reverse, so they have to be
+// reversed once read.
+func (f Filter) keysetConditions(column, key, id string) (string, string) {
+	direction := f.sortDirection()
+
+	if f.Before == nil {
+		op := ">"
+		if direction == "DESC" {
+			op = "<"
+		}
+		return fmt.Sprintf("(%s %s %s OR (%s = %s AND id > %s))", column, op, key, column, key, id),
+			fmt.Sprintf("%s %s, id ASC", column, direction)
+	}
+
+	op, reverse := "<", "DESC"
+	if direction == "DESC" {
+		op, reverse = ">", "ASC"
+	}
+	return fmt.Sprintf("(%s %s %s OR (%s = %s AND id < %s))", column, op, key, column, key, id),
+		fmt.Sprintf("%s %s, id DESC", column, reverse)
+}
+
+// cursor returns the cursor of a row given the value of its sort column.
+func (f Filter) cursor(key interface{}, id int) *Cursor {
+	var k string
+	switch key := key.(type) {
+	case string:
+		k = key
+	case int:
+		k = strconv.Itoa(key)
+	case int32:
+		k = strconv.Itoa(int(key))
+	case float64:
+		k = strconv.FormatFloat(key, 'g', -1, 64)
+	default:
+		k = fmt.Sprint(key)
+	}
+	return &Cursor{Sort: f.Sort, Key: k, ID: id}
+}
+
 func calculateMetadata(totalRecords, page, pageSize int) MetaData {
 	if totalRecords == 0 {
 		return MetaData{}
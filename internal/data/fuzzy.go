@@ -0,0 +1,158 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// normalizedQuery normalizes $1 the way title_normalized and name_normalized
+// are, so it can be compared to them.
+const normalizedQuery = `btrim(regexp_replace(lower($1), '[^[:alnum:]]+', ' ', 'g'))`
+
+// fuzzyThreshold is the trigram similarity from which the % operator matches.
+// The pg_trgm default of 0.3 misses common typos such as "matirx".
+const fuzzyThreshold = 0.2
+
+const (
+	SuggestionMovie  = "movie"
+	SuggestionPerson = "person"
+)
+
+var SuggestionTypes = []string{SuggestionMovie, SuggestionPerson}
+
+type Suggestion struct {
+	Type  string  `json:"type"`
+	ID    int     `json:"id"`
+	Label string  `json:"label"`
+	Year  int32   `json:"year,omitempty"`
+	Score float64 `json:"score"`
+}
+
+// withSimilarity runs fn in a transaction where the % operator of pg_trgm
+// matches from fuzzyThreshold.
+func withSimilarity(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	return withTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`, strconv.FormatFloat(fuzzyThreshold, 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// GetAllFuzzy returns a page of the movies whose title is similar to the
+// searched one, most similar first. It is meant as a fallback when the
+// full-text search of GetAll finds nothing, so it only pages by offset.
+func (m *MovieModel) GetAllFuzzy(search MovieSearch, filters Filter, fields ...string) ([]*Movie, MetaData, error) {
+	columns := movieColumns(fields...)
+	if len(fields) > 0 {
+		columns = movieColumns(append(fields[:len(fields):len(fields)], filters.sortColumn())...)
+	}
+
+	offset := (filters.Page - 1) * filters.PageSize
+
+	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), %s FROM movies
+	WHERE %s
+	ORDER BY similarity(title_normalized, %s) DESC, id ASC
+	LIMIT $10 OFFSET $11`, selectList(columns), movieFuzzyConditions, normalizedQuery)
+	movies := []*Movie{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	args := append(search.args()[:9], filters.PageSize, offset)
+
+	totalRecords := 0
+
+	err := withSimilarity(ctx, m.DB, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			movie := &Movie{}
+			err := rows.Scan(append([]interface{}{&totalRecords}, movieScanDest(movie, columns)...)...)
+			if err != nil {
+				return err
+			}
+			movies = append(movies, movie)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	return movies, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+type SuggestionModel struct {
+	DB *sql.DB
+}
+
+// suggestionQueries find the movies and people matching $1, either because
+// their title or name, or one of its words, starts with it or because it is
+// similar enough. Prefix matches rank above similar ones. The normalized term
+// is repeated rather than shared, so the planner folds it into a constant and
+// prefix matches can use the text_pattern_ops indexes.
+var suggestionQueries = map[string]string{
+	SuggestionMovie: `(SELECT 'movie', id, title, year,
+		(CASE WHEN title_normalized LIKE ` + normalizedQuery + ` || '%' THEN 1 WHEN title_normalized LIKE '% ' || ` + normalizedQuery + ` || '%' THEN 0.5 ELSE 0 END)
+		+ similarity(title_normalized, ` + normalizedQuery + `) AS score
+	FROM movies
+	WHERE deleted_at IS NULL AND ` + normalizedQuery + ` <> ''
+	AND (title_normalized LIKE ` + normalizedQuery + ` || '%' OR title_normalized LIKE '% ' || ` + normalizedQuery + ` || '%' OR title_normalized % ` + normalizedQuery + `)
+	ORDER BY score DESC, id
+	LIMIT $2)`,
+	SuggestionPerson: `(SELECT 'person', id, name, 0,
+		(CASE WHEN name_normalized LIKE ` + normalizedQuery + ` || '%' THEN 1 WHEN name_normalized LIKE '% ' || ` + normalizedQuery + ` || '%' THEN 0.5 ELSE 0 END)
+		+ similarity(name_normalized, ` + normalizedQuery + `) AS score
+	FROM people
+	WHERE ` + normalizedQuery + ` <> ''
+	AND (name_normalized LIKE ` + normalizedQuery + ` || '%' OR name_normalized LIKE '% ' || ` + normalizedQuery + ` || '%' OR name_normalized % ` + normalizedQuery + `)
+	ORDER BY score DESC, id
+	LIMIT $2)`,
+}
+
+// Get returns the best suggestions of the given types for what has been
+// typed so far.
+func (m SuggestionModel) Get(prefix string, types []string, limit int) ([]*Suggestion, error) {
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = suggestionQueries[t]
+	}
+	query := strings.Join(parts, "\n\tUNION ALL\n\t") + "\n\tORDER BY 5 DESC, 1, 2\n\tLIMIT $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	suggestions := []*Suggestion{}
+
+	err := withSimilarity(ctx, m.DB, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, prefix, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var s Suggestion
+			err := rows.Scan(&s.Type, &s.ID, &s.Label, &s.Year, &s.Score)
+			if err != nil {
+				return err
+			}
+			suggestions = append(suggestions, &s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,269 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ImagePoster = "poster"
+	ImageStill  = "still"
+)
+
+var ImageKinds = []string{ImagePoster, ImageStill}
+
+type Image struct {
+	ID          int               `json:"id"`
+	MovieID     int               `json:"movie_id"`
+	Kind        string            `json:"kind"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Checksum    string            `json:"-"`
+	Variants    pq.StringArray    `json:"-"`
+	URLs        map[string]string `json:"urls"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// Key is the storage key of one of the image variants. Keys are derived from
+// the checksum of the upload, so identical uploads share their stored files.
+func (i *Image) Key(variant string) string {
+	ext := ".jpg"
+	if i.ContentType == "image/png" {
+		ext = ".png"
+	}
+	return fmt.Sprintf("images/%s/%s/%s%s", i.Checksum[:2], i.Checksum, variant, ext)
+}
+
+func (i *Image) ETag(variant string) string {
+	return fmt.Sprintf(`"%s-%s"`, i.Checksum[:16], variant)
+}
+
+func (i *Image) setURLs() {
+	i.URLs = make(map[string]string, len(i.Variants))
+	for _, variant := range i.Variants {
+		i.URLs[variant] = fmt.Sprintf("/v1/images/%d/%s", i.ID, variant)
+	}
+}
+
+type ImageModel struct {
+	DB *sql.DB
+}
+
+func (m ImageModel) Insert(image *Image) error {
+	query := `INSERT INTO movie_images (movie_id, kind, content_type, width, height, checksum, variants)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at`
+
+	args := []interface{}{
+		image.MovieID,
+		image.Kind,
+		image.ContentType,
+		image.Width,
+		image.Height,
+		image.Checksum,
+		image.Variants,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt)
+	if err != nil {
+		return err
+	}
+	image.setURLs()
+	return nil
+}
+
+func (m ImageModel) Get(id int) (*Image, error) {
+	if id < 1 {
+		return nil, ErrNoRecordFound
+	}
+
+	query := `SELECT id, movie_id, kind, content_type, width, height, checksum, variants, created_at
+	FROM movie_images
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var image Image
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&image.ID,
+		&image.MovieID,
+		&image.Kind,
+		&image.ContentType,
+		&image.Width,
+		&image.Height,
+		&image.Checksum,
+		&image.Variants,
+		&image.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+	image.setURLs()
+	return &image, nil
+}
+
+func (m ImageModel) GetForMovies(movieIDs []int) (map[int][]*Image, error) {
+	query := `SELECT id, movie_id, kind, content_type, width, height, checksum, variants, created_at
+	FROM movie_images
+	WHERE movie_id = ANY($1)
+	ORDER BY movie_id, kind, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make(map[int][]*Image)
+
+	for rows.Next() {
+		var image Image
+		err := rows.Scan(
+			&image.ID,
+			&image.MovieID,
+			&image.Kind,
+			&image.ContentType,
+			&image.Width,
+			&image.Height,
+			&image.Checksum,
+			&image.Variants,
+			&image.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		image.setURLs()
+		images[image.MovieID] = append(images[image.MovieID], &image)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// Delete removes the image row and reports whether its stored files are still
+// referenced by another row.
+func (m ImageModel) Delete(image *Image) (bool, error) {
+	query := `WITH deleted AS (
+		DELETE FROM movie_images WHERE id = $1 AND movie_id = $2 RETURNING checksum
+	)
+	SELECT EXISTS (SELECT 1 FROM deleted), EXISTS (
+		SELECT 1 FROM movie_images WHERE checksum = $3 AND id <> $1
+	)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var deleted, shared bool
+
+	err := m.DB.QueryRowContext(ctx, query, image.ID, image.MovieID, image.Checksum).Scan(&deleted, &shared)
+	if err != nil {
+		return false, err
+	}
+	if !deleted {
+		return false, ErrNoRecordFound
+	}
+	return shared, nil
+}
+
+// Shared reports whether an image row references the files stored for the
+// checksum.
+func (m ImageModel) Shared(checksum string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM movie_images WHERE checksum = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var shared bool
+
+	err := m.DB.QueryRowContext(ctx, query, checksum).Scan(&shared)
+	return shared, err
+}
+
+// purgedImages returns the images of the movies about to be purged, one per
+// stored content.
+func purgedImages(ctx context.Context, tx *sql.Tx, movieIDs []int) ([]*Image, error) {
+	query := `SELECT DISTINCT ON (checksum) content_type, checksum, variants
+	FROM movie_images
+	WHERE movie_id = ANY($1)
+	ORDER BY checksum`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*Image
+
+	for rows.Next() {
+		var image Image
+		err := rows.Scan(&image.ContentType, &image.Checksum, &image.Variants)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, &image)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// unusedImages returns the images whose stored files no image references
+// anymore.
+func unusedImages(ctx context.Context, tx *sql.Tx, images []*Image) ([]*Image, error) {
+	if len(images) == 0 {
+		return nil, nil
+	}
+
+	checksums := make([]string, len(images))
+	for i, image := range images {
+		checksums[i] = image.Checksum
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT checksum FROM movie_images WHERE checksum = ANY($1)`, pq.Array(checksums))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shared := make(map[string]bool)
+	for rows.Next() {
+		var checksum string
+		if err := rows.Scan(&checksum); err != nil {
+			return nil, err
+		}
+		shared[checksum] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	unused := []*Image{}
+	for _, image := range images {
+		if !shared[image.Checksum] {
+			unused = append(unused, image)
+		}
+	}
+	return unused, nil
+}
@@ -0,0 +1,530 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"movies/internal/validator"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+
+	ImportBatchSize = 500
+)
+
+var (
+	ErrAmbiguousExternalIDs = errors.New("external ids point at more than one movie")
+)
+
+// ImportCSVColumns are the columns understood in CSV imports, genres being
+// separated by a pipe, e.g. Action|Sci-Fi.
+var ImportCSVColumns = []string{"title", "year", "runtime", "genres", "imdb", "tmdb", "wikidata"}
+
+type ImportRow struct {
+	Line   int
+	Movie  *Movie
+	Errors *validator.Validator
+	Action string
+}
+
+type ImportRowError struct {
+	Line   int                    `json:"line"`
+	Errors []validator.FieldError `json:"errors"`
+}
+
+// importRowError returns the errors of a row that fails for a single reason.
+func importRowError(key, code, message string) *validator.Validator {
+	v := validator.New()
+	v.AddError(key, code, message)
+	return v
+}
+
+type ImportOptions struct {
+	DryRun   bool
+	Upsert   bool
+	EditorID int
+}
+
+type ImportJob struct {
+	ID         int              `json:"id"`
+	UserID     int              `json:"user_id"`
+	Format     string           `json:"format"`
+	DryRun     bool             `json:"dry_run"`
+	Upsert     bool             `json:"upsert"`
+	Status     string           `json:"status"`
+	TotalRows  int              `json:"total_rows"`
+	Inserted   int              `json:"inserted"`
+	Updated    int              `json:"updated"`
+	Failed     int              `json:"failed"`
+	Errors     []ImportRowError `json:"errors"`
+	Error      string           `json:"error,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	// saved is how many of the errors are already stored
+	saved int
+}
+
+// Record adds the outcome of a processed batch of rows to the job counters and
+// error report.
+func (job *ImportJob) Record(rows []*ImportRow) {
+	for _, row := range rows {
+		job.TotalRows++
+		switch {
+		case row.Errors != nil:
+			job.Failed++
+			job.Errors = append(job.Errors, ImportRowError{Line: row.Line, Errors: row.Errors.FieldErrors()})
+		case row.Action == RevisionUpdate:
+			job.Updated++
+		default:
+			job.Inserted++
+		}
+	}
+}
+
+// ImportReader yields the movies of an import file one row at a time. Rows that
+// cannot be decoded are returned with their errors set rather than as an error,
+// which is reserved for problems with the file itself.
+type ImportReader interface {
+	Next() (*ImportRow, error)
+}
+
+func NewImportReader(format string, r io.Reader) (ImportReader, error) {
+	switch format {
+	case ImportFormatCSV:
+		return newCSVImportReader(r)
+	case ImportFormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		return &ndjsonImportReader{scanner: scanner}, nil
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the file is empty")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		// exports carry the movie id, which imports have no use for
+		known := name == "id"
+		for _, column := range ImportCSVColumns {
+			known = known || column == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q, columns must be among %s", name, strings.Join(ImportCSVColumns, ", "))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("the title column is required")
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvImportReader) Next() (*ImportRow, error) {
+	record, err := r.reader.Read()
+
+	var parseErr *csv.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		return &ImportRow{Line: parseErr.Line, Errors: importRowError("row", validator.CodeInvalid, parseErr.Err.Error())}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	// the position is only known for the fields of a record that was read
+	line, _ := r.reader.FieldPos(0)
+
+	row := &ImportRow{Line: line, Movie: &Movie{ExternalIDs: map[string]string{}}}
+
+	field := func(name string) string {
+		i, ok := r.columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	fail := func(key, message string) {
+		if row.Errors == nil {
+			row.Errors = validator.New()
+		}
+		row.Errors.AddError(key, validator.CodeInvalid, message)
+	}
+
+	row.Movie.Title = field("title")
+
+	if s := field("year"); s != "" {
+		year, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			fail("year", "year must be an integer")
+		}
+		row.Movie.Year = int32(year)
+	}
+	if s := field("runtime"); s != "" {
+		runtime, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			fail("runtime", "runtime must be an integer")
+		}
+		row.Movie.Runtime = int32(runtime)
+	}
+	if s := field("genres"); s != "" {
+		for _, genre := range strings.Split(s, "|") {
+			row.Movie.Genres = append(row.Movie.Genres, strings.TrimSpace(genre))
+		}
+	}
+	for _, provider := range []string{"imdb", "tmdb", "wikidata"} {
+		if value := field(provider); value != "" {
+			row.Movie.ExternalIDs[provider] = value
+		}
+	}
+	return row, nil
+}
+
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (r *ndjsonImportReader) Next() (*ImportRow, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var input struct {
+			Title          string            `json:"title"`
+			Year           int32             `json:"year"`
+			Runtime        int32             `json:"runtime"`
+			Genres         []string          `json:"genres"`
+			Localizations  []*Localization   `json:"localizations"`
+			Releases       []*Release        `json:"releases"`
+			Certifications []*Certification  `json:"certifications"`
+			ExternalIDs    map[string]string `json:"external_ids"`
+		}
+
+		if err := json.Unmarshal(line, &input); err != nil {
+			return &ImportRow{Line: r.line, Errors: importRowError("row", validator.CodeInvalid, "row must be a valid JSON object: "+err.Error())}, nil
+		}
+
+		return &ImportRow{Line: r.line, Movie: &Movie{
+			Title:          input.Title,
+			Year:           input.Year,
+			Runtime:        input.Runtime,
+			Genres:         input.Genres,
+			Localizations:  input.Localizations,
+			Releases:       input.Releases,
+			Certifications: input.Certifications,
+			ExternalIDs:    input.ExternalIDs,
+		}}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// ImportSession writes the batches of an import. Every batch is committed on
+// its own, except in dry runs where all of them share a transaction rolled back
+// when the session is closed, so rows are checked against the ones of earlier
+// batches.
+type ImportSession struct {
+	db   *sql.DB
+	opts ImportOptions
+	tx   *sql.Tx
+}
+
+func (m *MovieModel) NewImportSession(opts ImportOptions) (*ImportSession, error) {
+	session := &ImportSession{db: m.DB, opts: opts}
+
+	if opts.DryRun {
+		// the transaction outlives any single batch, so it isn't bound to a
+		// timeout, each batch has its own
+		tx, err := m.DB.BeginTx(context.Background(), nil)
+		if err != nil {
+			return nil, err
+		}
+		session.tx = tx
+	}
+	return session, nil
+}
+
+// Batch writes the valid rows of a batch. Every row runs in its own savepoint
+// so a row the database refuses is reported on that row without losing the
+// rest of the batch.
+func (s *ImportSession) Batch(rows []*ImportRow) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+
+	defer cancel()
+
+	if s.tx != nil {
+		return importRows(ctx, s.tx, rows, s.opts)
+	}
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return importRows(ctx, tx, rows, s.opts)
+	})
+}
+
+// Close ends the session, rolling back everything a dry run did.
+func (s *ImportSession) Close() error {
+	if s.tx != nil {
+		return s.tx.Rollback()
+	}
+	return nil
+}
+
+func importRows(ctx context.Context, tx *sql.Tx, rows []*ImportRow, opts ImportOptions) error {
+	for _, row := range rows {
+		if row.Errors != nil {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, `SAVEPOINT import_row`)
+		if err != nil {
+			return err
+		}
+
+		err = importMovie(ctx, tx, row, opts)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrDuplicateExternalID):
+				row.Errors = importRowError("external_ids", validator.CodeNotUnique, "an external id already points at another movie")
+			case errors.Is(err, ErrTrashedExternalID):
+				row.Errors = importRowError("external_ids", validator.CodeConflict, "an external id belongs to a movie in the trash, restore or purge that movie first")
+			case errors.Is(err, ErrAmbiguousExternalIDs):
+				row.Errors = importRowError("external_ids", validator.CodeConflict, "the external ids point at more than one movie")
+			default:
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row`)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT import_row`)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importMovie(ctx context.Context, tx *sql.Tx, row *ImportRow, opts ImportOptions) error {
+	movie := row.Movie
+
+	if opts.Upsert && len(movie.ExternalIDs) > 0 {
+		providers := make([]string, 0, len(movie.ExternalIDs))
+		values := make([]string, 0, len(movie.ExternalIDs))
+		for provider, value := range movie.ExternalIDs {
+			providers = append(providers, provider)
+			values = append(values, value)
+		}
+
+		query := `SELECT DISTINCT movies.id, movies.version, movies.deleted_at IS NOT NULL
+		FROM external_ids
+		INNER JOIN movies ON movies.id = external_ids.movie_id
+		WHERE (external_ids.provider, external_ids.value) IN (SELECT * FROM unnest($1::text[], $2::text[]))
+		FOR UPDATE OF movies`
+
+		rows, err := tx.QueryContext(ctx, query, pq.Array(providers), pq.Array(values))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		matches := 0
+		trashed := false
+		for rows.Next() {
+			matches++
+			if err := rows.Scan(&movie.ID, &movie.Version, &trashed); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		switch {
+		case matches > 1:
+			return ErrAmbiguousExternalIDs
+		case matches == 1 && trashed:
+			return ErrTrashedExternalID
+		case matches == 1:
+			// Keep the external ids of the existing movie that the row doesn't mention.
+			existing, err := tx.QueryContext(ctx, `SELECT provider, value FROM external_ids WHERE movie_id = $1`, movie.ID)
+			if err != nil {
+				return err
+			}
+			defer existing.Close()
+
+			for existing.Next() {
+				var provider, value string
+				if err := existing.Scan(&provider, &value); err != nil {
+					return err
+				}
+				if _, ok := movie.ExternalIDs[provider]; !ok {
+					movie.ExternalIDs[provider] = value
+				}
+			}
+			if err := existing.Err(); err != nil {
+				return err
+			}
+			existing.Close()
+
+			row.Action = RevisionUpdate
+			return updateMovie(ctx, tx, movie, opts.EditorID, RevisionUpdate, nil)
+		}
+	}
+
+	row.Action = RevisionCreate
+	return insertMovie(ctx, tx, movie, opts.EditorID)
+}
+
+type ImportJobModel struct {
+	DB *sql.DB
+}
+
+func (m ImportJobModel) Insert(job *ImportJob) error {
+	query := `INSERT INTO import_jobs (user_id, format, dry_run, upsert, status)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, job.UserID, job.Format, job.DryRun, job.Upsert, job.Status).Scan(&job.ID, &job.CreatedAt)
+}
+
+func (m ImportJobModel) Get(id int) (*ImportJob, error) {
+	if id < 1 {
+		return nil, ErrNoRecordFound
+	}
+
+	query := `SELECT id, user_id, format, dry_run, upsert, status, total_rows, inserted, updated, failed, errors, error, created_at, finished_at
+	FROM import_jobs
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job ImportJob
+	var report []byte
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Format,
+		&job.DryRun,
+		&job.Upsert,
+		&job.Status,
+		&job.TotalRows,
+		&job.Inserted,
+		&job.Updated,
+		&job.Failed,
+		&report,
+		&job.Error,
+		&job.CreatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(report, &job.Errors)
+	if err != nil {
+		return nil, err
+	}
+	job.saved = len(job.Errors)
+	return &job, nil
+}
+
+// Update saves the progress of the job. Only the errors added since the last
+// update are written, they are appended to the stored ones.
+func (m ImportJobModel) Update(job *ImportJob) error {
+	query := `UPDATE import_jobs
+	SET status = $1, total_rows = $2, inserted = $3, updated = $4, failed = $5, errors = errors || $6::jsonb, error = $7, finished_at = $8
+	WHERE id = $9`
+
+	added := job.Errors[job.saved:]
+	if added == nil {
+		added = []ImportRowError{}
+	}
+
+	report, err := json.Marshal(added)
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{job.Status, job.TotalRows, job.Inserted, job.Updated, job.Failed, report, job.Error, job.FinishedAt, job.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	job.saved = len(job.Errors)
+	return nil
+}
+
+// FailInterrupted marks the jobs left unfinished by a previous run of the
+// server as failed.
+func (m ImportJobModel) FailInterrupted() error {
+	query := `UPDATE import_jobs
+	SET status = 'failed', error = 'the import was interrupted by a server restart', finished_at = NOW()
+	WHERE status IN ('pending', 'running')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query)
+	return err
+}
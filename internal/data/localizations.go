@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"movies/internal/validator"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Localization struct {
+	Language   string `json:"language"`
+	Title      string `json:"title"`
+	Tagline    string `json:"tagline,omitempty"`
+	Overview   string `json:"overview,omitempty"`
+	IsOriginal bool   `json:"is_original"`
+}
+
+// CanonicalLanguage normalizes the casing of a BCP 47 tag, e.g. "pt-br" becomes "pt-BR"
+// and "zh-hant-tw" becomes "zh-Hant-TW".
+func CanonicalLanguage(tag string) string {
+	parts := strings.Split(tag, "-")
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case len(part) == 4:
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		default:
+			parts[i] = strings.ToUpper(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func primaryLanguage(tag string) string {
+	primary, _, _ := strings.Cut(tag, "-")
+	return strings.ToLower(primary)
+}
+
+func ValidateLocalizations(v *validator.Validator, localizations []*Localization) {
+	languages := make([]string, 0, len(localizations))
+	originals := 0
+
+	for _, l := range localizations {
+		v.Check(l.Language != "", "localizations", validator.CodeRequired, "language must be provided for every localization")
+		v.Check(validator.Matches(l.Language, validator.LanguageTagRX), "localizations", validator.CodeInvalid, "language must be a valid BCP 47 tag such as en or pt-BR")
+		v.Check(l.Title != "", "localizations", validator.CodeRequired, "title must be provided for every localization")
+		v.Check(validator.MaxChars(l.Title, 500), "localizations", validator.CodeTooLong, "title should be less than or equal to 500 characters long")
+		v.Check(validator.MaxChars(l.Tagline, 500), "localizations", validator.CodeTooLong, "tagline should be less than or equal to 500 characters long")
+		v.Check(validator.MaxChars(l.Overview, 10_000), "localizations", validator.CodeTooLong, "overview should be less than or equal to 10000 characters long")
+
+		languages = append(languages, CanonicalLanguage(l.Language))
+		if l.IsOriginal {
+			originals++
+		}
+	}
+
+	v.Check(validator.Unique(languages), "localizations", validator.CodeNotUnique, "localizations must contain unique languages")
+	v.Check(originals <= 1, "localizations", validator.CodeNotUnique, "only one localization can be marked as original")
+}
+
+// Localize picks the localized fields of the movie that best match the given language
+// preferences, falling back to the original locale and then to the stored title.
+func (movie *Movie) Localize(localizations []*Localization, languages []string) {
+	var match, original *Localization
+
+	for _, l := range localizations {
+		if l.IsOriginal {
+			original = l
+		}
+	}
+
+	for _, language := range languages {
+		for _, l := range localizations {
+			if strings.EqualFold(l.Language, language) {
+				match = l
+				break
+			}
+		}
+		if match != nil {
+			break
+		}
+		for _, l := range localizations {
+			if primaryLanguage(l.Language) == primaryLanguage(language) {
+				match = l
+				break
+			}
+		}
+		if match != nil {
+			break
+		}
+	}
+
+	if match == nil {
+		match = original
+	}
+	if match == nil {
+		return
+	}
+
+	if match.Title != movie.Title {
+		movie.OriginalTitle = movie.Title
+	}
+	movie.Title = match.Title
+	movie.Tagline = match.Tagline
+	movie.Overview = match.Overview
+	movie.Language = match.Language
+}
+
+type LocalizationModel struct {
+	DB *sql.DB
+}
+
+func (m LocalizationModel) GetForMovies(movieIDs []int) (map[int][]*Localization, error) {
+	query := `SELECT movie_id, language, title, tagline, overview, is_original
+	FROM movie_localizations
+	WHERE movie_id = ANY($1)
+	ORDER BY movie_id, is_original DESC, language`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	localizations := make(map[int][]*Localization)
+
+	for rows.Next() {
+		var movieID int
+		var l Localization
+		err := rows.Scan(&movieID, &l.Language, &l.Title, &l.Tagline, &l.Overview, &l.IsOriginal)
+		if err != nil {
+			return nil, err
+		}
+		localizations[movieID] = append(localizations[movieID], &l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return localizations, nil
+}
+
+func replaceLocalizations(ctx context.Context, tx *sql.Tx, movieID int, localizations []*Localization) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM movie_localizations WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_localizations (movie_id, language, title, tagline, overview, is_original)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+
+	for _, l := range localizations {
+		l.Language = CanonicalLanguage(l.Language)
+		_, err := tx.ExecContext(ctx, query, movieID, l.Language, l.Title, l.Tagline, l.Overview, l.IsOriginal)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
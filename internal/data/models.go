@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -11,17 +12,60 @@ var (
 )
 
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies        MovieModel
+	Users         UserModel
+	Tokens        TokenModel
+	Permissions   PermissionModel
+	Localizations LocalizationModel
+	Releases      ReleaseModel
+	Images        ImageModel
+	ExternalIDs   ExternalIDModel
+	Videos        VideoModel
+	Revisions     RevisionModel
+	Proposals     ProposalModel
+	ImportJobs    ImportJobModel
+	Credits       CreditModel
+	Suggestions   SuggestionModel
+	Ratings       RatingModel
+	Watchlist     WatchlistModel
+	Similarities  SimilarityModel
+	Stats         StatsModel
+	Views         ViewModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:        MovieModel{DB: db},
+		Users:         UserModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		Localizations: LocalizationModel{DB: db},
+		Releases:      ReleaseModel{DB: db},
+		Images:        ImageModel{DB: db},
+		ExternalIDs:   ExternalIDModel{DB: db},
+		Videos:        VideoModel{DB: db},
+		Revisions:     RevisionModel{DB: db},
+		Proposals:     ProposalModel{DB: db},
+		ImportJobs:    ImportJobModel{DB: db},
+		Credits:       CreditModel{DB: db},
+		Suggestions:   SuggestionModel{DB: db},
+		Ratings:       RatingModel{DB: db},
+		Watchlist:     WatchlistModel{DB: db},
+		Similarities:  SimilarityModel{DB: db},
+		Stats:         StatsModel{DB: db},
+		Views:         ViewModel{DB: db},
 	}
 }
+
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
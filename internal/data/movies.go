@@ -6,68 +6,274 @@ import (
 	"errors"
 	"fmt"
 	"movies/internal/validator"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 )
 
 type Movie struct {
-	ID        int            `json:"id"`
-	Title     string         `json:"title"`
-	Year      int32          `json:"year,omitempty"`
-	Runtime   int32          `json:"runtime,omitempty"`
-	Genres    pq.StringArray `json:"genres,omitempty"`
-	CreatedAt time.Time      `json:"-"`
-	Version   int32          `json:"version"`
+	ID             int               `json:"id"`
+	Title          string            `json:"title"`
+	OriginalTitle  string            `json:"original_title,omitempty"`
+	Language       string            `json:"language,omitempty"`
+	Tagline        string            `json:"tagline,omitempty"`
+	Overview       string            `json:"overview,omitempty"`
+	Year           int32             `json:"year,omitempty"`
+	Runtime        int32             `json:"runtime,omitempty"`
+	Genres         pq.StringArray    `json:"genres,omitempty"`
+	Localizations  []*Localization   `json:"localizations,omitempty"`
+	Releases       []*Release        `json:"releases,omitempty"`
+	Certifications []*Certification  `json:"certifications,omitempty"`
+	Images         []*Image          `json:"images,omitempty"`
+	ExternalIDs    map[string]string `json:"external_ids,omitempty"`
+	Trailer        *Video            `json:"trailer,omitempty"`
+	Credits        []*Credit         `json:"credits,omitempty"`
+	Ratings        *RatingSummary    `json:"ratings,omitempty"`
+	Headline       string            `json:"headline,omitempty"`
+	Relevance      float64           `json:"-"`
+	Popularity     float64           `json:"-"`
+	DeletedAt      *time.Time        `json:"deleted_at,omitempty"`
+	CreatedAt      time.Time         `json:"-"`
+	Version        int32             `json:"version"`
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
 	// title validation
-	v.Check(movie.Title != "", "title", "title must be provided")
-	v.Check(len(movie.Title) <= 500, "title", "title should be less than or equal to 500 characters long")
+	v.Check(movie.Title != "", "title", validator.CodeRequired, "title must be provided")
+	v.Check(len(movie.Title) <= 500, "title", validator.CodeTooLong, "title should be less than or equal to 500 characters long")
 
 	// year validation
-	v.Check(movie.Year != 0, "year", "year must be provided")
-	v.Check(movie.Year >= 1888 && movie.Year <= int32(time.Now().Year()), "year", "year must be between 1888 and the current year")
+	v.Check(movie.Year != 0, "year", validator.CodeRequired, "year must be provided")
+	v.Check(movie.Year >= 1888 && movie.Year <= int32(time.Now().Year()+10), "year", validator.CodeOutOfRange, "year must be between 1888 and 10 years from now")
 
 	// runtime validation
-	v.Check(movie.Runtime > 0, "runtime", "runtime must be provided and a positive integer")
+	v.Check(movie.Runtime > 0, "runtime", validator.CodeRequired, "runtime must be provided and a positive integer")
 
 	// genres validation
-	v.Check(movie.Genres != nil, "genres", "genres must be provided")
-	v.Check(len(movie.Genres) >= 1 && len(movie.Genres) <= 5, "genres", "genres most contain at least 1 and no more than 5 items")
-	v.Check(validator.Unique(movie.Genres), "genres", "genres must contain unique items")
+	v.Check(movie.Genres != nil, "genres", validator.CodeRequired, "genres must be provided")
+	v.Check(len(movie.Genres) >= 1 && len(movie.Genres) <= 5, "genres", validator.CodeOutOfRange, "genres most contain at least 1 and no more than 5 items")
+	v.Check(validator.Unique(movie.Genres), "genres", validator.CodeNotUnique, "genres must contain unique items")
+
+	// localizations validation
+	ValidateLocalizations(v, movie.Localizations)
+
+	// releases and certifications validation
+	ValidateReleases(v, movie.Releases)
+	ValidateCertifications(v, movie.Certifications)
+
+	// external ids validation
+	ValidateExternalIDs(v, movie.ExternalIDs)
+}
+
+type MovieSearch struct {
+	Title          string
+	Genres         []string
+	ReleasedBefore *time.Time
+	ReleasedAfter  *time.Time
+	Country        string
+	// Language picks the text search configuration the title is parsed with.
+	Language string
+	// the ranges are inclusive, zero leaves a bound open
+	YearMin    int
+	YearMax    int
+	RuntimeMin int
+	RuntimeMax int
+}
+
+func ValidateMovieSearch(v *validator.Validator, search MovieSearch) {
+	v.Check(search.Country == "" || validator.Matches(search.Country, validator.CountryRX), "country", validator.CodeInvalid, "country must be an ISO 3166-1 alpha-2 code such as US")
+	v.Check(search.YearMin >= 0 && search.YearMax >= 0, "year", validator.CodeOutOfRange, "year_min and year_max must be positive integers")
+	v.Check(search.YearMin == 0 || search.YearMax == 0 || search.YearMin <= search.YearMax, "year", validator.CodeOutOfRange, "year_min must not be greater than year_max")
+	v.Check(search.RuntimeMin >= 0 && search.RuntimeMax >= 0, "runtime", validator.CodeOutOfRange, "runtime_min and runtime_max must be positive integers")
+	v.Check(search.RuntimeMin == 0 || search.RuntimeMax == 0 || search.RuntimeMin <= search.RuntimeMax, "runtime", validator.CodeOutOfRange, "runtime_min must not be greater than runtime_max")
 }
 
 type MovieModel struct {
 	DB *sql.DB
 }
 
-func (m *MovieModel) GetAll(title string, genres pq.StringArray, filters Filter) ([]*Movie, MetaData, error) {
+// MovieFields lists the fields of a movie a sparse fieldset can pick from.
+var MovieFields = []string{"id", "title", "original_title", "language", "tagline", "overview", "year", "runtime", "genres", "version", "headline"}
+
+// movieColumns returns the columns of the movies table needed for the given
+// fields, all of them when no field is given. The id, creation date and
+// version are always read.
+func movieColumns(fields ...string) []string {
+	if len(fields) == 0 {
+		return []string{"id", "created_at", "title", "year", "runtime", "genres", "version"}
+	}
+
+	columns := []string{"id", "created_at", "version"}
+	for _, column := range []string{"title", "year", "runtime", "genres"} {
+		for _, field := range fields {
+			if field == column || (column == "title" && field == "original_title") {
+				columns = append(columns, column)
+				break
+			}
+		}
+	}
+	return columns
+}
+
+func movieScanDest(movie *Movie, columns []string) []interface{} {
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			dest[i] = &movie.ID
+		case "created_at":
+			dest[i] = &movie.CreatedAt
+		case "title":
+			dest[i] = &movie.Title
+		case "year":
+			dest[i] = &movie.Year
+		case "runtime":
+			dest[i] = &movie.Runtime
+		case "genres":
+			dest[i] = &movie.Genres
+		case "version":
+			dest[i] = &movie.Version
+		case "relevance":
+			dest[i] = &movie.Relevance
+		case "popularity":
+			dest[i] = &movie.Popularity
+		case "headline":
+			dest[i] = &movie.Headline
+		}
+	}
+	return dest
+}
+
+// The conditions of a MovieSearch take their arguments as $1 to $10 in the
+// order returned by MovieSearch.args. The genre, year and runtime conditions
+// are kept apart so facets can leave out their own.
+const (
+	// movieTextQuery parses the title search in the web search syntax, both
+	// stemmed for the requested language and as is.
+	movieTextQuery = `(websearch_to_tsquery(search_config($10), $1) || websearch_to_tsquery('simple', $1))`
+
+	movieReleaseCondition = `(($3::date IS NULL AND $4::date IS NULL AND $5 = '') OR EXISTS (
+		SELECT 1 FROM movie_releases r WHERE r.movie_id = movies.id
+		AND (r.release_date < $3::date OR $3::date IS NULL)
+		AND (r.release_date > $4::date OR $4::date IS NULL)
+		AND (r.country = $5 OR $5 = '')))`
+
+	movieBaseConditions = `deleted_at IS NULL
+	AND ($1 = '' OR search_vector @@ ` + movieTextQuery + `)
+	AND ` + movieReleaseCondition
+	movieGenresCondition  = `(genres @> $2 OR $2 = '{}')`
+	movieYearCondition    = `(year >= $6 OR $6 = 0) AND (year <= $7 OR $7 = 0)`
+	movieRuntimeCondition = `(runtime >= $8 OR $8 = 0) AND (runtime <= $9 OR $9 = 0)`
+
+	// movieSearchConditions filters movies by a MovieSearch.
+	movieSearchConditions = movieBaseConditions + `
+	AND ` + movieGenresCondition + `
+	AND ` + movieYearCondition + `
+	AND ` + movieRuntimeCondition
+
+	// movieFuzzyConditions filters movies like movieSearchConditions but
+	// matches the title by trigram similarity instead of full-text search.
+	// It doesn't use the language, so it takes its arguments as $1 to $9.
+	movieFuzzyConditions = `deleted_at IS NULL
+	AND title_normalized % ` + normalizedQuery + `
+	AND ` + movieReleaseCondition + `
+	AND ` + movieGenresCondition + `
+	AND ` + movieYearCondition + `
+	AND ` + movieRuntimeCondition
+)
+
+// movieComputedColumns are the values read alongside the columns of a movie
+// when searching.
+var movieComputedColumns = map[string]string{
+	"relevance": `ts_rank_cd(search_vector, ` + movieTextQuery + `)`,
+	"headline": `CASE WHEN $1 = '' THEN '' ELSE ts_headline(search_config($10), title || COALESCE((
+		SELECT ' - ' || l.overview FROM movie_localizations l
+		WHERE l.movie_id = movies.id AND l.overview <> ''
+		ORDER BY lower(split_part(l.language, '-', 1)) = lower(split_part($10, '-', 1)) DESC, l.is_original DESC
+		LIMIT 1
+	), ''), ` + movieTextQuery + `, 'MaxFragments=2, MinWords=5, MaxWords=20, StartSel=<mark>, StopSel=</mark>') END`,
+}
+
+func (s MovieSearch) args() []interface{} {
+	return []interface{}{s.Title, pq.Array(s.Genres), s.ReleasedBefore, s.ReleasedAfter, s.Country, s.YearMin, s.YearMax, s.RuntimeMin, s.RuntimeMax, s.Language}
+}
+
+// searchColumns adds the values a search needs to the columns: the relevance
+// or popularity when sorting by it and the headline when searching a title.
+func (s MovieSearch) searchColumns(columns []string, filters Filter, fields []string) []string {
+	columns = columns[:len(columns):len(columns)]
+	switch filters.sortColumn() {
+	case "relevance", "popularity":
+		columns = append(columns, filters.sortColumn())
+	}
+	if s.Title != "" && (len(fields) == 0 || validator.In("headline", fields...)) {
+		columns = append(columns, "headline")
+	}
+	return columns
+}
+
+// selectList returns the SQL select list reading the columns.
+func selectList(columns []string) string {
+	list := make([]string, len(columns))
+	for i, column := range columns {
+		if expression, ok := movieComputedColumns[column]; ok {
+			list[i] = expression + " AS " + column
+		} else {
+			list[i] = column
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// movieSortExpression returns what the movies are ordered by, which is the
+// sort column unless it is computed.
+func movieSortExpression(filters Filter) string {
+	if expression, ok := movieComputedColumns[filters.sortColumn()]; ok {
+		return expression
+	}
+	return filters.sortColumn()
+}
+
+// GetAll returns a page of the movies matching the search. When fields are
+// given only the columns they need are read, along with the sort column.
+func (m *MovieModel) GetAll(search MovieSearch, filters Filter, fields ...string) ([]*Movie, MetaData, error) {
+	columns := movieColumns(fields...)
+	if len(fields) > 0 {
+		columns = movieColumns(append(fields[:len(fields):len(fields)], filters.sortColumn())...)
+	}
+	columns = search.searchColumns(columns, filters, fields)
+
+	if filters.keyset() {
+		return m.getAllKeyset(search, filters, columns)
+	}
+
 	offset := (filters.Page - 1) * filters.PageSize
 
-	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version FROM movies 
-	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1='') 
-	AND (genres @> $2 OR $2 = '{}') 
+	args := search.args()
+
+	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), %s FROM movies 
+	WHERE %s
 	ORDER BY %s %s,id ASC 
-	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	LIMIT $%d OFFSET $%d`, selectList(columns), movieSearchConditions, movieSortExpression(filters), filters.sortDirection(), len(args)+1, len(args)+2)
 	movies := []*Movie{}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(genres), filters.PageSize, offset}
+	args = append(args, filters.PageSize, offset)
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, MetaData{}, err
 	}
+	defer rows.Close()
 
 	totalRecords := 0
 	for rows.Next() {
 		movie := &Movie{}
-		err := rows.Scan(&totalRecords, &movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, &movie.Genres, &movie.Version)
+		err := rows.Scan(append([]interface{}{&totalRecords}, movieScanDest(movie, columns)...)...)
 		if err != nil {
 			return nil, MetaData{}, err
 		}
@@ -77,10 +283,125 @@ func (m *MovieModel) GetAll(title string, genres pq.StringArray, filters Filter)
 		return nil, MetaData{}, err
 	}
 	metaData := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	if len(movies) > 0 {
+		if offset+len(movies) < totalRecords {
+			metaData.NextCursor = filters.cursor(movieSortKey(movies[len(movies)-1], filters), movies[len(movies)-1].ID)
+		}
+		if filters.Page > 1 {
+			metaData.PrevCursor = filters.cursor(movieSortKey(movies[0], filters), movies[0].ID)
+		}
+	}
 	return movies, metaData, nil
 }
 
-func (m *MovieModel) Insert(movie *Movie) error {
+// getAllKeyset reads the page of movies after or before the cursor of the
+// filters. One more row than the page size is read to know whether there is
+// another page past this one.
+func (m *MovieModel) getAllKeyset(search MovieSearch, filters Filter, columns []string) ([]*Movie, MetaData, error) {
+	cursor := filters.After
+	if cursor == nil {
+		cursor = filters.Before
+	}
+
+	args := search.args()
+
+	conditions, order := filters.keysetConditions(movieSortExpression(filters), fmt.Sprintf("$%d", len(args)+1), fmt.Sprintf("$%d", len(args)+2))
+
+	query := fmt.Sprintf(`SELECT %s FROM movies
+	WHERE %s
+	AND %s
+	ORDER BY %s
+	LIMIT $%d`, selectList(columns), movieSearchConditions, conditions, order, len(args)+3)
+	movies := []*Movie{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	args = append(args, cursor.Key, cursor.ID, filters.PageSize+1)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		movie := &Movie{}
+		err := rows.Scan(movieScanDest(movie, columns)...)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+		movies = append(movies, movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	more := len(movies) > filters.PageSize
+	if more {
+		movies = movies[:filters.PageSize]
+	}
+	if filters.Before != nil {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+
+	metaData := MetaData{PageSize: filters.PageSize}
+
+	if len(movies) > 0 {
+		first, last := movies[0], movies[len(movies)-1]
+		if filters.After != nil || more {
+			metaData.PrevCursor = filters.cursor(movieSortKey(first, filters), first.ID)
+		}
+		if filters.Before != nil || more {
+			metaData.NextCursor = filters.cursor(movieSortKey(last, filters), last.ID)
+		}
+	}
+
+	if filters.IncludeTotal {
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM movies WHERE %s`, movieSearchConditions)
+
+		err := m.DB.QueryRowContext(ctx, query, search.args()...).Scan(&metaData.TotalRecords)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+	}
+
+	return movies, metaData, nil
+}
+
+// movieSortKey returns the value of the column the movies are sorted by.
+func movieSortKey(movie *Movie, filters Filter) interface{} {
+	switch filters.sortColumn() {
+	case "title":
+		return movie.Title
+	case "year":
+		return movie.Year
+	case "runtime":
+		return movie.Runtime
+	case "relevance":
+		return movie.Relevance
+	case "popularity":
+		return movie.Popularity
+	default:
+		return movie.ID
+	}
+}
+
+func (m *MovieModel) Insert(movie *Movie, editorID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return insertMovie(ctx, tx, movie, editorID)
+	})
+}
+
+func insertMovie(ctx context.Context, tx *sql.Tx, movie *Movie, editorID int) error {
 	query := `INSERT INTO movies (title, year, runtime, genres) VALUES ($1, $2, $3, $4) RETURNING id, created_at, version`
 	args := []interface{}{
 		movie.Title,
@@ -88,26 +409,66 @@ func (m *MovieModel) Insert(movie *Movie) error {
 		movie.Runtime,
 		movie.Genres,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
-	defer cancel()
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	err = saveMovieRelations(ctx, tx, movie)
+	if err != nil {
+		return err
+	}
+
+	return insertRevision(ctx, tx, movie.ID, RevisionCreate, editorID, nil)
+}
+
+func saveMovieRelations(ctx context.Context, tx *sql.Tx, movie *Movie) error {
+	if movie.Localizations != nil {
+		err := replaceLocalizations(ctx, tx, movie.ID, movie.Localizations)
+		if err != nil {
+			return err
+		}
+	}
+	if movie.Releases != nil {
+		err := replaceReleases(ctx, tx, movie.ID, movie.Releases)
+		if err != nil {
+			return err
+		}
+	}
+	if movie.Certifications != nil {
+		err := replaceCertifications(ctx, tx, movie.ID, movie.Certifications)
+		if err != nil {
+			return err
+		}
+	}
+	if movie.ExternalIDs != nil {
+		err := replaceExternalIDs(ctx, tx, movie.ID, movie.ExternalIDs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (m *MovieModel) Get(id int) (*Movie, error) {
+// Get returns the movie with the given id. When fields are given only the
+// columns they need are read.
+func (m *MovieModel) Get(id int, fields ...string) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrNoRecordFound
 	}
 
 	var movie Movie
 
-	query := `SELECT id, created_at, title, year, runtime, genres, version FROM movies WHERE id = $1`
+	columns := movieColumns(fields...)
+
+	query := fmt.Sprintf(`SELECT %s FROM movies WHERE id = $1 AND deleted_at IS NULL`, strings.Join(columns, ", "))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, &movie.Genres, &movie.Version)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(movieScanDest(&movie, columns)...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -119,9 +480,70 @@ func (m *MovieModel) Get(id int) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m *MovieModel) Update(movie *Movie) error {
+// GetMany returns the movies with the given ids in the order they were asked
+// for, leaving out the ids that don't match a movie. When fields are given only
+// the columns they need are read.
+func (m *MovieModel) GetMany(ids []int, fields ...string) ([]*Movie, error) {
+	columns := movieColumns(fields...)
+
+	query := fmt.Sprintf(`SELECT %s FROM movies WHERE id = ANY($1) AND deleted_at IS NULL`, strings.Join(columns, ", "))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[int]*Movie, len(ids))
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(movieScanDest(&movie, columns)...)
+		if err != nil {
+			return nil, err
+		}
+		found[movie.ID] = &movie
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	movies := make([]*Movie, 0, len(found))
+	for _, id := range ids {
+		if movie, ok := found[id]; ok {
+			movies = append(movies, movie)
+			delete(found, id)
+		}
+	}
+	return movies, nil
+}
+
+func (m *MovieModel) Update(movie *Movie, editorID int) error {
+	return m.update(movie, editorID, RevisionUpdate, nil)
+}
+
+// Restore writes the state of an earlier revision as a new version of the movie,
+// the movie carrying the version it is expected to have right now.
+func (m *MovieModel) Restore(movie *Movie, editorID int, fromVersion int32) error {
+	return m.update(movie, editorID, RevisionRestore, &fromVersion)
+}
+
+func (m *MovieModel) update(movie *Movie, editorID int, action string, restoredFrom *int32) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return updateMovie(ctx, tx, movie, editorID, action, restoredFrom)
+	})
+}
+
+func updateMovie(ctx context.Context, tx *sql.Tx, movie *Movie, editorID int, action string, restoredFrom *int32) error {
 	query := `UPDATE movies SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-	WHERE id = $5 AND version = $6 RETURNING version`
+	WHERE id = $5 AND version = $6 AND deleted_at IS NULL RETURNING version`
 
 	args := []interface{}{
 		movie.Title,
@@ -132,44 +554,242 @@ func (m *MovieModel) Update(movie *Movie) error {
 		movie.Version,
 	}
 
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = saveMovieRelations(ctx, tx, movie)
+	if err != nil {
+		return err
+	}
+
+	return insertRevision(ctx, tx, movie.ID, action, editorID, restoredFrom)
+}
+
+// Delete moves the movie to the trash, it stays there until it is restored or purged.
+// When a version is given the movie must still be at that version.
+func (m *MovieModel) Delete(id int, version *int32, editorID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return deleteMovie(ctx, tx, id, version, editorID)
+	})
+}
+
+// deleteMovie moves a movie to the trash. When a version is given the movie must
+// still be at that version.
+func deleteMovie(ctx context.Context, tx *sql.Tx, id int, version *int32, editorID int) error {
+	if id < 1 {
+		return ErrNoRecordFound
+	}
+
+	query := `UPDATE movies SET deleted_at = NOW(), version = version + 1
+	WHERE id = $1 AND deleted_at IS NULL AND ($2::integer IS NULL OR version = $2)`
+
+	result, err := tx.ExecContext(ctx, query, id, version)
 	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		if version == nil {
+			return ErrNoRecordFound
+		}
+
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM movies WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists)
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		case exists:
 			return ErrEditConflict
 		default:
-			return err
+			return ErrNoRecordFound
 		}
 	}
-	return nil
+
+	return insertRevision(ctx, tx, id, RevisionDelete, editorID, nil)
+}
+
+func (m *MovieModel) GetTrash(filters Filter) ([]*Movie, MetaData, error) {
+	offset := (filters.Page - 1) * filters.PageSize
+
+	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at FROM movies
+	WHERE deleted_at IS NOT NULL
+	ORDER BY %s %s, id ASC
+	LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.PageSize, offset)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+	for rows.Next() {
+		movie := &Movie{}
+		err := rows.Scan(&totalRecords, &movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, &movie.Genres, &movie.Version, &movie.DeletedAt)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+		movies = append(movies, movie)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+	return movies, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
 }
 
-func (m *MovieModel) Delete(id int) error {
+// Undelete takes a movie out of the trash as a new version.
+func (m *MovieModel) Undelete(id int, editorID int) (*Movie, error) {
 	if id < 1 {
-		return ErrNoRecordFound
+		return nil, ErrNoRecordFound
 	}
 
-	query := `DELETE FROM movies WHERE id = $1`
+	query := `UPDATE movies SET deleted_at = NULL, version = version + 1
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	RETURNING id, created_at, title, year, runtime, genres, version`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	var movie Movie
+
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, id).Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, &movie.Genres, &movie.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNoRecordFound
+			default:
+				return err
+			}
+		}
+
+		return insertRevision(ctx, tx, id, RevisionUndelete, editorID, nil)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &movie, nil
+}
 
-	rowsAffected, err := result.RowsAffected()
+// Purge permanently removes a movie that is in the trash. Its revision history is
+// kept, ending with a purge revision. It returns the images that went away with
+// the movie and whose files no other image references, so they can be deleted.
+func (m *MovieModel) Purge(id int, editorID int) ([]*Image, error) {
+	if id < 1 {
+		return nil, ErrNoRecordFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+	defer cancel()
+
+	var unused []*Image
+
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		ids, images, err := purgeMovies(ctx, tx, editorID, `UPDATE movies SET version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL RETURNING id`, id)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrNoRecordFound
+		}
+		unused = images
+		return nil
+	})
 	if err != nil {
+		return nil, err
+	}
+	return unused, nil
+}
+
+// PurgeExpired permanently removes every movie that has been in the trash for
+// longer than the retention period. It returns how many were removed and the
+// images that went away with them and whose files are no longer referenced.
+func (m *MovieModel) PurgeExpired(retention time.Duration) (int, []*Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	defer cancel()
+
+	var purged int
+	var unused []*Image
+
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		// expired movies are purged by the system rather than by a user
+		ids, images, err := purgeMovies(ctx, tx, 0, `UPDATE movies SET version = version + 1 WHERE deleted_at < $1 RETURNING id`, time.Now().Add(-retention))
+		purged = len(ids)
+		unused = images
 		return err
+	})
+	if err != nil {
+		return 0, nil, err
 	}
-	if rowsAffected == 0 {
-		return ErrNoRecordFound
+	return purged, unused, nil
+}
+
+// purgeMovies removes the movies the query returns the ids of, recording a
+// purge revision by the editor for each of them. Their images are removed with
+// them, the ones whose files no remaining image references are returned.
+func purgeMovies(ctx context.Context, tx *sql.Tx, editorID int, selectQuery string, args ...interface{}) ([]int, []*Image, error) {
+	rows, err := tx.QueryContext(ctx, selectQuery, args...)
+	if err != nil {
+		return nil, nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		err := insertRevision(ctx, tx, id, RevisionPurge, editorID, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	images, err := purgedImages(ctx, tx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movies WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unused, err := unusedImages(ctx, tx, images)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ids, unused, nil
 }
@@ -0,0 +1,283 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"movies/internal/jsonpatch"
+	"movies/internal/validator"
+	"time"
+)
+
+const (
+	ProposalPending          = "pending"
+	ProposalApproved         = "approved"
+	ProposalRejected         = "rejected"
+	ProposalChangesRequested = "changes_requested"
+)
+
+var ProposalStatuses = []string{ProposalPending, ProposalApproved, ProposalRejected, ProposalChangesRequested}
+
+// ErrProposalConflict is returned when approving a proposal that has changed
+// since it was read, as opposed to the movie having changed.
+var ErrProposalConflict = errors.New("proposal edit conflict")
+
+type Proposal struct {
+	ID             int             `json:"id"`
+	MovieID        int             `json:"movie_id"`
+	AuthorID       int             `json:"author_id"`
+	BaseVersion    int32           `json:"base_version"`
+	Patch          json.RawMessage `json:"patch"`
+	Rationale      string          `json:"rationale"`
+	Status         string          `json:"status"`
+	ModeratorID    *int            `json:"moderator_id,omitempty"`
+	ModeratorNote  string          `json:"moderator_note,omitempty"`
+	AppliedVersion *int32          `json:"applied_version,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Version        int32           `json:"version"`
+	AuthorName     string          `json:"-"`
+	AuthorEmail    string          `json:"-"`
+}
+
+func ValidateProposal(v *validator.Validator, proposal *Proposal) {
+	v.Check(proposal.BaseVersion >= 1, "base_version", validator.CodeRequired, "base_version must be provided and a positive integer")
+
+	v.Check(proposal.Rationale != "", "rationale", validator.CodeRequired, "rationale must be provided")
+	v.Check(validator.MaxChars(proposal.Rationale, 2000), "rationale", validator.CodeTooLong, "rationale should be less than or equal to 2000 characters long")
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(proposal.Patch, &fields)
+	v.Check(err == nil && fields != nil, "patch", validator.CodeInvalid, "patch must be a JSON merge patch object")
+	v.Check(err != nil || len(fields) > 0, "patch", validator.CodeRequired, "patch must change at least one field")
+	for field := range fields {
+		v.Check(validator.In(field, diffFields...), "patch", validator.CodeNotAllowed, fmt.Sprintf("%s cannot be changed through a proposal", field))
+	}
+}
+
+// ApplyMergePatch returns a copy of the movie with the editable fields replaced
+// by the result of applying a JSON merge patch to them.
+func ApplyMergePatch(movie *Movie, patch []byte) (*Movie, error) {
+	return patchMovie(movie, patch, jsonpatch.MergePatch)
+}
+
+// ApplyJSONPatch returns a copy of the movie with the editable fields replaced
+// by the result of applying a JSON patch to them.
+func ApplyJSONPatch(movie *Movie, patch []byte) (*Movie, error) {
+	return patchMovie(movie, patch, jsonpatch.Apply)
+}
+
+// patchMovie applies the patch to the document of the movie, which must hold
+// all of its collections so they can be patched item by item.
+func patchMovie(movie *Movie, patch []byte, apply func(doc, patch []byte) ([]byte, error)) (*Movie, error) {
+	document := newMovieDocument(movie)
+	document.fillCollections()
+
+	js, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err = apply(js, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	document = movieDocument{}
+	if err := json.Unmarshal(js, &document); err != nil {
+		return nil, err
+	}
+	// a collection the patch set to null is cleared, like an empty one
+	document.fillCollections()
+
+	patched := *movie
+	patched.Title = document.Title
+	patched.Year = document.Year
+	patched.Runtime = document.Runtime
+	patched.Genres = document.Genres
+	patched.Localizations = document.Localizations
+	patched.Releases = document.Releases
+	patched.Certifications = document.Certifications
+	patched.ExternalIDs = document.ExternalIDs
+	return &patched, nil
+}
+
+type ProposalModel struct {
+	DB *sql.DB
+}
+
+func (m ProposalModel) Insert(proposal *Proposal) error {
+	query := `INSERT INTO edit_proposals (movie_id, author_id, base_version, patch, rationale)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, status, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{proposal.MovieID, proposal.AuthorID, proposal.BaseVersion, []byte(proposal.Patch), proposal.Rationale}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&proposal.ID, &proposal.Status, &proposal.CreatedAt, &proposal.UpdatedAt, &proposal.Version)
+}
+
+func (m ProposalModel) Get(id int) (*Proposal, error) {
+	if id < 1 {
+		return nil, ErrNoRecordFound
+	}
+
+	query := `SELECT p.id, p.movie_id, p.author_id, p.base_version, p.patch, p.rationale, p.status, p.moderator_id,
+	p.moderator_note, p.applied_version, p.created_at, p.updated_at, p.version, users.name, users.email
+	FROM edit_proposals p
+	INNER JOIN users ON users.id = p.author_id
+	WHERE p.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var proposal Proposal
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&proposal.ID,
+		&proposal.MovieID,
+		&proposal.AuthorID,
+		&proposal.BaseVersion,
+		&proposal.Patch,
+		&proposal.Rationale,
+		&proposal.Status,
+		&proposal.ModeratorID,
+		&proposal.ModeratorNote,
+		&proposal.AppliedVersion,
+		&proposal.CreatedAt,
+		&proposal.UpdatedAt,
+		&proposal.Version,
+		&proposal.AuthorName,
+		&proposal.AuthorEmail,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+	return &proposal, nil
+}
+
+func (m ProposalModel) GetAll(status string, movieID int, filters Filter) ([]*Proposal, MetaData, error) {
+	offset := (filters.Page - 1) * filters.PageSize
+
+	query := fmt.Sprintf(`SELECT COUNT(*) OVER(), id, movie_id, author_id, base_version, patch, rationale, status, moderator_id,
+	moderator_note, applied_version, created_at, updated_at, version
+	FROM edit_proposals
+	WHERE (status = $1 OR $1 = '')
+	AND (movie_id = $2 OR $2 = 0)
+	ORDER BY %s %s, id ASC
+	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, movieID, filters.PageSize, offset)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	proposals := []*Proposal{}
+
+	for rows.Next() {
+		var proposal Proposal
+		err := rows.Scan(
+			&totalRecords,
+			&proposal.ID,
+			&proposal.MovieID,
+			&proposal.AuthorID,
+			&proposal.BaseVersion,
+			&proposal.Patch,
+			&proposal.Rationale,
+			&proposal.Status,
+			&proposal.ModeratorID,
+			&proposal.ModeratorNote,
+			&proposal.AppliedVersion,
+			&proposal.CreatedAt,
+			&proposal.UpdatedAt,
+			&proposal.Version,
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+		proposals = append(proposals, &proposal)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+	return proposals, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m ProposalModel) Update(proposal *Proposal) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return updateProposal(ctx, tx, proposal)
+	})
+}
+
+// Approve applies the movie the proposal results in and marks the proposal as
+// approved by the moderator, both or neither. The movie must still be at the
+// version the proposal was written against.
+func (m ProposalModel) Approve(proposal *Proposal, movie *Movie, moderatorID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := updateMovie(ctx, tx, movie, moderatorID, RevisionUpdate, nil)
+		if err != nil {
+			return err
+		}
+
+		proposal.Status = ProposalApproved
+		proposal.ModeratorID = &moderatorID
+		proposal.AppliedVersion = &movie.Version
+
+		err = updateProposal(ctx, tx, proposal)
+		if errors.Is(err, ErrEditConflict) {
+			return ErrProposalConflict
+		}
+		return err
+	})
+}
+
+func updateProposal(ctx context.Context, tx *sql.Tx, proposal *Proposal) error {
+	query := `UPDATE edit_proposals
+	SET base_version = $1, patch = $2, rationale = $3, status = $4, moderator_id = $5, moderator_note = $6,
+	applied_version = $7, updated_at = NOW(), version = version + 1
+	WHERE id = $8 AND version = $9
+	RETURNING updated_at, version`
+
+	args := []interface{}{
+		proposal.BaseVersion,
+		[]byte(proposal.Patch),
+		proposal.Rationale,
+		proposal.Status,
+		proposal.ModeratorID,
+		proposal.ModeratorNote,
+		proposal.AppliedVersion,
+		proposal.ID,
+		proposal.Version,
+	}
+
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&proposal.UpdatedAt, &proposal.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"movies/internal/validator"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Rating struct {
+	MovieID   int       `json:"movie_id"`
+	Score     int       `json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RatingSummary aggregates the ratings given to a movie.
+type RatingSummary struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Score >= 1 && rating.Score <= 10, "score", validator.CodeOutOfRange, "score must be between 1 and 10")
+}
+
+type RatingModel struct {
+	DB *sql.DB
+}
+
+// Upsert records the rating of a movie by a user, replacing the one they gave
+// before if any.
+func (m RatingModel) Upsert(userID int, rating *Rating) error {
+	query := `INSERT INTO movie_ratings (user_id, movie_id, score)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, movie_id) DO UPDATE SET score = EXCLUDED.score, updated_at = NOW()
+	RETURNING created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, userID, rating.MovieID, rating.Score).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+}
+
+func (m RatingModel) Delete(userID, movieID int) error {
+	query := `DELETE FROM movie_ratings WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+	return nil
+}
+
+// GetSummariesForMovies returns the number and mean of the ratings of every
+// movie. Movies nobody has rated are summarized with a count of zero.
+func (m RatingModel) GetSummariesForMovies(movieIDs []int) (map[int]*RatingSummary, error) {
+	query := `SELECT movie_id, COUNT(*), AVG(score)
+	FROM movie_ratings
+	WHERE movie_id = ANY($1)
+	GROUP BY movie_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make(map[int]*RatingSummary, len(movieIDs))
+	for _, id := range movieIDs {
+		summaries[id] = &RatingSummary{}
+	}
+
+	for rows.Next() {
+		var movieID int
+		var summary RatingSummary
+		err := rows.Scan(&movieID, &summary.Count, &summary.Mean)
+		if err != nil {
+			return nil, err
+		}
+		summaries[movieID] = &summary
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
@@ -0,0 +1,222 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"movies/internal/validator"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ReleaseTheatrical = "theatrical"
+	ReleaseDigital    = "digital"
+	ReleasePhysical   = "physical"
+	ReleaseTV         = "tv"
+)
+
+var ReleaseTypes = []string{ReleaseTheatrical, ReleaseDigital, ReleasePhysical, ReleaseTV}
+
+type certificationSystem struct {
+	country string
+	ratings []string
+}
+
+var certificationSystems = map[string]certificationSystem{
+	"MPAA": {country: "US", ratings: []string{"G", "PG", "PG-13", "R", "NC-17"}},
+	"BBFC": {country: "GB", ratings: []string{"U", "PG", "12", "12A", "15", "18", "R18"}},
+	"FSK":  {country: "DE", ratings: []string{"0", "6", "12", "16", "18"}},
+	"ACB":  {country: "AU", ratings: []string{"G", "PG", "M", "MA15+", "R18+", "X18+"}},
+}
+
+type Release struct {
+	Country     string `json:"country"`
+	Type        string `json:"type"`
+	ReleaseDate string `json:"release_date"`
+	Note        string `json:"note,omitempty"`
+}
+
+type Certification struct {
+	System  string `json:"system"`
+	Country string `json:"country"`
+	Rating  string `json:"rating"`
+}
+
+type UpcomingRelease struct {
+	MovieID int    `json:"movie_id"`
+	Title   string `json:"title"`
+	Release
+}
+
+func ValidateReleases(v *validator.Validator, releases []*Release) {
+	keys := make([]string, 0, len(releases))
+
+	for _, r := range releases {
+		v.Check(validator.Matches(r.Country, validator.CountryRX), "releases", validator.CodeInvalid, "country must be an ISO 3166-1 alpha-2 code such as US")
+		v.Check(validator.In(r.Type, ReleaseTypes...), "releases", validator.CodeNotAllowed, "type must be one of theatrical, digital, physical or tv")
+
+		date, err := time.Parse(time.DateOnly, r.ReleaseDate)
+		v.Check(err == nil, "releases", validator.CodeInvalid, "release_date must be a date in the YYYY-MM-DD format")
+		v.Check(err != nil || date.Year() >= 1888, "releases", validator.CodeOutOfRange, "release_date must not be before 1888")
+		v.Check(validator.MaxChars(r.Note, 500), "releases", validator.CodeTooLong, "note should be less than or equal to 500 characters long")
+
+		keys = append(keys, r.Country+"/"+r.Type)
+	}
+
+	v.Check(validator.Unique(keys), "releases", validator.CodeNotUnique, "releases must contain at most one release per country and type")
+}
+
+func ValidateCertifications(v *validator.Validator, certifications []*Certification) {
+	systems := make([]string, 0, len(certifications))
+
+	for _, c := range certifications {
+		system, ok := certificationSystems[c.System]
+		v.Check(ok, "certifications", validator.CodeNotAllowed, "system must be one of MPAA, BBFC, FSK or ACB")
+		v.Check(!ok || validator.In(c.Rating, system.ratings...), "certifications", validator.CodeInvalid, "rating is not valid for the given system")
+		systems = append(systems, c.System)
+	}
+
+	v.Check(validator.Unique(systems), "certifications", validator.CodeNotUnique, "certifications must contain at most one rating per system")
+}
+
+type ReleaseModel struct {
+	DB *sql.DB
+}
+
+func (m ReleaseModel) GetForMovies(movieIDs []int) (map[int][]*Release, error) {
+	query := `SELECT movie_id, country, type, to_char(release_date, 'YYYY-MM-DD'), note
+	FROM movie_releases
+	WHERE movie_id = ANY($1)
+	ORDER BY movie_id, release_date, country`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := make(map[int][]*Release)
+
+	for rows.Next() {
+		var movieID int
+		var r Release
+		err := rows.Scan(&movieID, &r.Country, &r.Type, &r.ReleaseDate, &r.Note)
+		if err != nil {
+			return nil, err
+		}
+		releases[movieID] = append(releases[movieID], &r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+func (m ReleaseModel) GetCertificationsForMovies(movieIDs []int) (map[int][]*Certification, error) {
+	query := `SELECT movie_id, system, country, rating
+	FROM movie_certifications
+	WHERE movie_id = ANY($1)
+	ORDER BY movie_id, country`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certifications := make(map[int][]*Certification)
+
+	for rows.Next() {
+		var movieID int
+		var c Certification
+		err := rows.Scan(&movieID, &c.System, &c.Country, &c.Rating)
+		if err != nil {
+			return nil, err
+		}
+		certifications[movieID] = append(certifications[movieID], &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return certifications, nil
+}
+
+func (m ReleaseModel) GetUpcoming(country string, filters Filter) ([]*UpcomingRelease, MetaData, error) {
+	offset := (filters.Page - 1) * filters.PageSize
+
+	query := `SELECT COUNT(*) OVER(), movies.id, movies.title, r.country, r.type, to_char(r.release_date, 'YYYY-MM-DD'), r.note
+	FROM movie_releases r
+	INNER JOIN movies ON movies.id = r.movie_id
+	WHERE r.release_date >= CURRENT_DATE
+	AND movies.deleted_at IS NULL
+	AND (r.country = $1 OR $1 = '')
+	ORDER BY r.release_date ` + filters.sortDirection() + `, movies.id ASC
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, country, filters.PageSize, offset)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	releases := []*UpcomingRelease{}
+
+	for rows.Next() {
+		var r UpcomingRelease
+		err := rows.Scan(&totalRecords, &r.MovieID, &r.Title, &r.Country, &r.Type, &r.ReleaseDate, &r.Note)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+		releases = append(releases, &r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+	return releases, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func replaceReleases(ctx context.Context, tx *sql.Tx, movieID int, releases []*Release) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM movie_releases WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_releases (movie_id, country, type, release_date, note) VALUES ($1, $2, $3, $4, $5)`
+
+	for _, r := range releases {
+		_, err := tx.ExecContext(ctx, query, movieID, r.Country, r.Type, r.ReleaseDate, r.Note)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replaceCertifications(ctx context.Context, tx *sql.Tx, movieID int, certifications []*Certification) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM movie_certifications WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_certifications (movie_id, system, country, rating) VALUES ($1, $2, $3, $4)`
+
+	for _, c := range certifications {
+		c.Country = certificationSystems[c.System].country
+		_, err := tx.ExecContext(ctx, query, movieID, c.System, c.Country, c.Rating)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
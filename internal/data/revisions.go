@@ -0,0 +1,189 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionRestore  = "restore"
+	RevisionDelete   = "delete"
+	RevisionUndelete = "undelete"
+	RevisionPurge    = "purge"
+	RevisionMerge    = "merge"
+)
+
+type Revision struct {
+	MovieID      int       `json:"movie_id"`
+	Version      int32     `json:"version"`
+	Action       string    `json:"action"`
+	EditorID     *int      `json:"editor_id,omitempty"`
+	RestoredFrom *int32    `json:"restored_from,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	Snapshot     *Movie    `json:"snapshot,omitempty"`
+}
+
+type FieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+var diffFields = []string{"title", "year", "runtime", "genres", "localizations", "releases", "certifications", "external_ids"}
+
+// DiffSnapshots compares two movie snapshots field by field and returns the
+// fields whose values differ.
+func DiffSnapshots(from, to *Movie) ([]FieldChange, error) {
+	fromFields, err := snapshotFields(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := snapshotFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FieldChange{}
+	for _, field := range diffFields {
+		if !bytes.Equal(fromFields[field], toFields[field]) {
+			changes = append(changes, FieldChange{Field: field, From: fromFields[field], To: toFields[field]})
+		}
+	}
+	return changes, nil
+}
+
+// movieDocument holds the fields of a movie that are tracked by revisions and
+// can be changed through a patch.
+type movieDocument struct {
+	Title          string            `json:"title"`
+	Year           int32             `json:"year"`
+	Runtime        int32             `json:"runtime"`
+	Genres         []string          `json:"genres"`
+	Localizations  []*Localization   `json:"localizations"`
+	Releases       []*Release        `json:"releases"`
+	Certifications []*Certification  `json:"certifications"`
+	ExternalIDs    map[string]string `json:"external_ids"`
+}
+
+func newMovieDocument(movie *Movie) movieDocument {
+	return movieDocument{movie.Title, movie.Year, movie.Runtime, movie.Genres, movie.Localizations, movie.Releases, movie.Certifications, movie.ExternalIDs}
+}
+
+// fillCollections replaces the missing collections of the document with empty
+// ones.
+func (d *movieDocument) fillCollections() {
+	if d.Localizations == nil {
+		d.Localizations = []*Localization{}
+	}
+	if d.Releases == nil {
+		d.Releases = []*Release{}
+	}
+	if d.Certifications == nil {
+		d.Certifications = []*Certification{}
+	}
+	if d.ExternalIDs == nil {
+		d.ExternalIDs = map[string]string{}
+	}
+}
+
+func snapshotFields(movie *Movie) (map[string]json.RawMessage, error) {
+	js, err := json.Marshal(newMovieDocument(movie))
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(js, &fields)
+	return fields, err
+}
+
+func insertRevision(ctx context.Context, tx *sql.Tx, movieID int, action string, editorID int, restoredFrom *int32) error {
+	query := `INSERT INTO movie_revisions (movie_id, version, action, snapshot, editor_id, restored_from)
+	SELECT id, version, $2, movie_snapshot(id), NULLIF($3, 0), $4
+	FROM movies
+	WHERE id = $1`
+
+	_, err := tx.ExecContext(ctx, query, movieID, action, editorID, restoredFrom)
+	return err
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+func (m RevisionModel) GetAll(movieID int, filters Filter) ([]*Revision, MetaData, error) {
+	offset := (filters.Page - 1) * filters.PageSize
+
+	query := `SELECT COUNT(*) OVER(), movie_id, version, action, editor_id, restored_from, created_at
+	FROM movie_revisions
+	WHERE movie_id = $1
+	ORDER BY version ` + filters.sortDirection() + `
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.PageSize, offset)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		var revision Revision
+		err := rows.Scan(&totalRecords, &revision.MovieID, &revision.Version, &revision.Action, &revision.EditorID, &revision.RestoredFrom, &revision.CreatedAt)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+	return revisions, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m RevisionModel) Get(movieID int, version int32) (*Revision, error) {
+	query := `SELECT movie_id, version, action, editor_id, restored_from, created_at, snapshot
+	FROM movie_revisions
+	WHERE movie_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var revision Revision
+	var snapshot []byte
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Action,
+		&revision.EditorID,
+		&revision.RestoredFrom,
+		&revision.CreatedAt,
+		&snapshot,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(snapshot, &revision.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
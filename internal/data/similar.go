@@ -0,0 +1,307 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The score of a similar movie is a weighted sum of how much the two movies
+// have in common, each part ranging from 0 to 1.
+const (
+	similarGenreWeight    = 0.4
+	similarYearWeight     = 0.1
+	similarPeopleWeight   = 0.3
+	similarAudienceWeight = 0.2
+)
+
+// similarMoviesPerMovie is how many similar movies are kept for every movie.
+const similarMoviesPerMovie = 50
+
+// similarYearCandidates is how many of the movies sharing a genre are scored
+// for every movie on each side of its year, the closest in year first.
+const similarYearCandidates = 200
+
+type Similarity struct {
+	Genre    float64 `json:"genre"`
+	Year     float64 `json:"year"`
+	People   float64 `json:"people"`
+	Audience float64 `json:"audience"`
+}
+
+type SimilarMovie struct {
+	MovieID    int        `json:"-"`
+	Score      float64    `json:"score"`
+	Similarity Similarity `json:"similarity"`
+}
+
+type Recommendation struct {
+	MovieID int     `json:"-"`
+	Score   float64 `json:"score"`
+	// Because lists the movies rated or watchlisted by the user that weigh
+	// the most in the recommendation.
+	Because []int `json:"because"`
+}
+
+type SimilarityModel struct {
+	DB *sql.DB
+}
+
+// refreshSimilarMoviesQuery scores, for every movie of the batch $1, the other
+// movies sharing a genre and released within 10 years of it, sharing cast or
+// crew with it, or liked by the same users. Genres are compared with their
+// Jaccard index, the year by its distance, and people and audiences with
+// their cosine similarity. The best $2 are kept. Only the $3 movies sharing a
+// genre released the closest before and after it are candidates, walking
+// movies_year_idx from its year, as popular genres hold far too many movies
+// to score them all.
+var refreshSimilarMoviesQuery = fmt.Sprintf(`WITH batch AS (
+		SELECT id, genres, year FROM movies WHERE id = ANY($1) AND deleted_at IS NULL
+	),
+	people AS (
+		SELECT a.movie_id, b.movie_id AS similar_id, COUNT(DISTINCT a.person_id) AS shared
+		FROM movie_credits a
+		INNER JOIN movie_credits b ON b.person_id = a.person_id AND b.movie_id <> a.movie_id
+		WHERE a.movie_id IN (SELECT id FROM batch)
+		GROUP BY 1, 2
+	),
+	audience AS (
+		SELECT a.movie_id, b.movie_id AS similar_id, COUNT(*) AS shared
+		FROM movie_likes a
+		INNER JOIN movie_likes b ON b.user_id = a.user_id AND b.movie_id <> a.movie_id
+		WHERE a.movie_id IN (SELECT id FROM batch)
+		GROUP BY 1, 2
+	),
+	credit_counts AS (
+		SELECT movie_id, COUNT(DISTINCT person_id) AS n FROM movie_credits
+		WHERE movie_id IN (SELECT id FROM batch) OR movie_id IN (SELECT similar_id FROM people)
+		GROUP BY movie_id
+	),
+	like_counts AS (
+		SELECT movie_id, COUNT(*) AS n FROM movie_likes
+		WHERE movie_id IN (SELECT id FROM batch) OR movie_id IN (SELECT similar_id FROM audience)
+		GROUP BY movie_id
+	),
+	candidates AS (
+		SELECT b.id AS movie_id, o.id AS similar_id
+		FROM batch b
+		CROSS JOIN LATERAL (
+			(SELECT m.id FROM movies m
+			WHERE m.deleted_at IS NULL AND m.year BETWEEN b.year AND b.year + 10
+			AND m.genres && b.genres AND m.id <> b.id
+			ORDER BY m.year, m.id
+			LIMIT $3)
+			UNION ALL
+			(SELECT m.id FROM movies m
+			WHERE m.deleted_at IS NULL AND m.year BETWEEN b.year - 10 AND b.year - 1
+			AND m.genres && b.genres
+			ORDER BY m.year DESC, m.id DESC
+			LIMIT $3)
+		) o
+		UNION
+		SELECT movie_id, similar_id FROM people
+		UNION
+		SELECT movie_id, similar_id FROM audience
+	),
+	scored AS (
+		SELECT c.movie_id, c.similar_id,
+		array_jaccard(b.genres, o.genres) AS genre_score,
+		GREATEST(0, 1 - abs(b.year - o.year) / 20.0) AS year_score,
+		COALESCE(p.shared / sqrt(pa.n * pb.n), 0) AS people_score,
+		COALESCE(a.shared / sqrt(la.n * lb.n), 0) AS audience_score
+		FROM candidates c
+		INNER JOIN batch b ON b.id = c.movie_id
+		INNER JOIN movies o ON o.id = c.similar_id AND o.deleted_at IS NULL
+		LEFT JOIN people p ON p.movie_id = c.movie_id AND p.similar_id = c.similar_id
+		LEFT JOIN credit_counts pa ON pa.movie_id = c.movie_id
+		LEFT JOIN credit_counts pb ON pb.movie_id = c.similar_id
+		LEFT JOIN audience a ON a.movie_id = c.movie_id AND a.similar_id = c.similar_id
+		LEFT JOIN like_counts la ON la.movie_id = c.movie_id
+		LEFT JOIN like_counts lb ON lb.movie_id = c.similar_id
+	),
+	ranked AS (
+		SELECT *, row_number() OVER (PARTITION BY movie_id ORDER BY score DESC, similar_id) AS rank
+		FROM (
+			SELECT *, %v * genre_score + %v * year_score + %v * people_score + %v * audience_score AS score
+			FROM scored
+		) s
+	)
+	INSERT INTO similar_movies (movie_id, similar_id, score, genre_score, year_score, people_score, audience_score)
+	SELECT movie_id, similar_id, score, genre_score, year_score, people_score, audience_score
+	FROM ranked
+	WHERE rank <= $2`, similarGenreWeight, similarYearWeight, similarPeopleWeight, similarAudienceWeight)
+
+// Refresh recomputes the similar movies of at most batchSize of the movies
+// whose similar movies haven't been computed in the last maxAge, the stalest
+// first. It returns how many movies it went through. A batch that can't be
+// refreshed keeps its previous similar movies but is still marked as
+// refreshed, so the next batch isn't stuck behind it until maxAge elapses.
+func (m SimilarityModel) Refresh(batchSize int, maxAge time.Duration) (int, error) {
+	ids, err := m.stale(batchSize, maxAge)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err = withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM similar_movies WHERE movie_id = ANY($1)`, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, refreshSimilarMoviesQuery, pq.Array(ids), similarMoviesPerMovie, similarYearCandidates)
+		if err != nil {
+			return err
+		}
+
+		return markRefreshed(ctx, tx, ids)
+	})
+	if err != nil {
+		markCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		markErr := withTx(markCtx, m.DB, func(tx *sql.Tx) error {
+			return markRefreshed(markCtx, tx, ids)
+		})
+		if markErr != nil {
+			return 0, markErr
+		}
+		return len(ids), fmt.Errorf("skipping %d movies from id %d: %w", len(ids), ids[0], err)
+	}
+	return len(ids), nil
+}
+
+// stale returns at most batchSize of the movies whose similar movies haven't
+// been computed in the last maxAge, the stalest first.
+func (m SimilarityModel) stale(batchSize int, maxAge time.Duration) ([]int, error) {
+	query := `SELECT m.id FROM movies m
+	LEFT JOIN similar_movies_refreshes r ON r.movie_id = m.id
+	WHERE m.deleted_at IS NULL AND (r.refreshed_at IS NULL OR r.refreshed_at < $1)
+	ORDER BY r.refreshed_at NULLS FIRST, m.id
+	LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-maxAge), batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func markRefreshed(ctx context.Context, tx *sql.Tx, ids []int) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO similar_movies_refreshes (movie_id)
+	SELECT unnest($1::bigint[])
+	ON CONFLICT (movie_id) DO UPDATE SET refreshed_at = NOW()`, pq.Array(ids))
+	return err
+}
+
+// GetSimilar returns the movies most similar to a movie, best first.
+func (m SimilarityModel) GetSimilar(movieID, limit int) ([]*SimilarMovie, error) {
+	query := `SELECT s.similar_id, s.score, s.genre_score, s.year_score, s.people_score, s.audience_score
+	FROM similar_movies s
+	INNER JOIN movies m ON m.id = s.similar_id
+	WHERE s.movie_id = $1 AND m.deleted_at IS NULL
+	ORDER BY s.score DESC, s.similar_id
+	LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	similar := []*SimilarMovie{}
+
+	for rows.Next() {
+		var s SimilarMovie
+		err := rows.Scan(&s.MovieID, &s.Score, &s.Similarity.Genre, &s.Similarity.Year, &s.Similarity.People, &s.Similarity.Audience)
+		if err != nil {
+			return nil, err
+		}
+		similar = append(similar, &s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return similar, nil
+}
+
+// Recommend returns the movies a user is the most likely to enjoy, using the
+// movies they rated or put on their watchlist as seeds. Every seed lends its
+// similar movies its weight, from 1 for a 10/10 down to -1 for a 1/10 so that
+// movies like the ones they disliked sink. Movies they already rated or
+// watchlisted aren't recommended.
+func (m SimilarityModel) Recommend(userID, limit int) ([]*Recommendation, error) {
+	query := `WITH seeds AS (
+		SELECT movie_id, (score - 5.5) / 4.5 AS weight FROM movie_ratings WHERE user_id = $1
+		UNION ALL
+		SELECT movie_id, 0.5 FROM watchlist_items
+		WHERE user_id = $1 AND movie_id NOT IN (SELECT movie_id FROM movie_ratings WHERE user_id = $1)
+	),
+	recommended AS (
+		SELECT s.similar_id, SUM(seeds.weight * s.score) AS score,
+		(array_agg(s.movie_id ORDER BY seeds.weight * s.score DESC) FILTER (WHERE seeds.weight > 0))[1:3] AS because
+		FROM seeds
+		INNER JOIN similar_movies s ON s.movie_id = seeds.movie_id
+		WHERE s.similar_id NOT IN (SELECT movie_id FROM seeds)
+		GROUP BY s.similar_id
+	)
+	SELECT r.similar_id, r.score, COALESCE(r.because, '{}')
+	FROM recommended r
+	INNER JOIN movies m ON m.id = r.similar_id
+	WHERE m.deleted_at IS NULL AND r.score > 0
+	ORDER BY r.score DESC, r.similar_id
+	LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recommendations := []*Recommendation{}
+
+	for rows.Next() {
+		var r Recommendation
+		var because pq.Int64Array
+		err := rows.Scan(&r.MovieID, &r.Score, &because)
+		if err != nil {
+			return nil, err
+		}
+		r.Because = make([]int, len(because))
+		for i, id := range because {
+			r.Because[i] = int(id)
+		}
+		recommendations = append(recommendations, &r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return recommendations, nil
+}
@@ -0,0 +1,179 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// statsViews are the materialized views the statistics are read from.
+var statsViews = []string{"movie_rating_counts", "movie_contributions"}
+
+// runtimePercentiles are the percentiles of the runtime distribution.
+var runtimePercentiles = []float64{0.1, 0.25, 0.5, 0.75, 0.9}
+
+type RuntimeStats struct {
+	Min         int                `json:"min"`
+	Max         int                `json:"max"`
+	Mean        float64            `json:"mean"`
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+type RatingStats struct {
+	Count        int           `json:"count"`
+	Mean         float64       `json:"mean"`
+	Distribution []*FacetCount `json:"distribution"`
+}
+
+type Contributor struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	Edits  int    `json:"edits"`
+	Movies int    `json:"movies"`
+}
+
+type Stats struct {
+	Movies       int            `json:"movies"`
+	Genres       []*FacetCount  `json:"genres"`
+	Decades      []*FacetCount  `json:"decades"`
+	Runtime      RuntimeStats   `json:"runtime"`
+	Additions    []*FacetCount  `json:"additions"`
+	Ratings      RatingStats    `json:"ratings"`
+	Contributors []*Contributor `json:"contributors"`
+}
+
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// statsQuery runs the query over the movies matching a MovieSearch, which it
+// can read from the matching table.
+func statsQuery(query string) string {
+	return fmt.Sprintf(`WITH matching AS (
+		SELECT id, genres, year, runtime, created_at FROM movies WHERE %s
+	)
+	%s`, movieSearchConditions, query)
+}
+
+// Get computes the statistics of the movies matching the search. Additions
+// are counted by month over the last given number of months. Ratings and
+// contributors come from materialized views, so they lag behind by up to the
+// refresh interval.
+func (m StatsModel) Get(search MovieSearch, months int) (*Stats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stats := &Stats{
+		Genres:       []*FacetCount{},
+		Decades:      []*FacetCount{},
+		Additions:    []*FacetCount{},
+		Contributors: []*Contributor{},
+		Runtime:      RuntimeStats{Percentiles: make(map[string]float64, len(runtimePercentiles))},
+		Ratings:      RatingStats{Distribution: []*FacetCount{}},
+	}
+
+	args := search.args()
+
+	var percentiles pq.Float64Array
+	err := m.DB.QueryRowContext(ctx, statsQuery(`SELECT COUNT(*), COALESCE(MIN(runtime), 0), COALESCE(MAX(runtime), 0), COALESCE(AVG(runtime), 0),
+	percentile_cont($11::float8[]) WITHIN GROUP (ORDER BY runtime)
+	FROM matching`), append(args, pq.Array(runtimePercentiles))...).Scan(&stats.Movies, &stats.Runtime.Min, &stats.Runtime.Max, &stats.Runtime.Mean, &percentiles)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range percentiles {
+		stats.Runtime.Percentiles[fmt.Sprintf("p%d", int(runtimePercentiles[i]*100))] = p
+	}
+
+	counts := []struct {
+		into  *[]*FacetCount
+		query string
+		args  []interface{}
+	}{
+		{&stats.Genres, `SELECT genre, COUNT(*) FROM matching, unnest(genres) AS genre
+		GROUP BY genre ORDER BY 2 DESC, 1`, args},
+		{&stats.Decades, `SELECT (year / 10 * 10)::text || 's', COUNT(*) FROM matching
+		GROUP BY year / 10 ORDER BY year / 10`, args},
+		{&stats.Additions, `SELECT to_char(month, 'YYYY-MM'), COUNT(m.id)
+		FROM generate_series(date_trunc('month', NOW()) - ($11::int - 1) * interval '1 month', date_trunc('month', NOW()), interval '1 month') AS month
+		LEFT JOIN matching m ON date_trunc('month', m.created_at) = month
+		GROUP BY month ORDER BY month`, append(args, months)},
+		{&stats.Ratings.Distribution, `SELECT s.score::text, COALESCE(SUM(r.ratings), 0)
+		FROM generate_series(1, 10) AS s(score)
+		LEFT JOIN (
+			SELECT rc.score, rc.ratings FROM movie_rating_counts rc INNER JOIN matching m ON m.id = rc.movie_id
+		) r ON r.score = s.score
+		GROUP BY s.score ORDER BY s.score`, args},
+	}
+
+	for _, count := range counts {
+		rows, err := m.DB.QueryContext(ctx, statsQuery(count.query), count.args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var fc FacetCount
+			if err := rows.Scan(&fc.Value, &fc.Count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			*count.into = append(*count.into, &fc)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// the distribution holds a count for every score from 1 to 10, in order
+	total := 0
+	for i, fc := range stats.Ratings.Distribution {
+		stats.Ratings.Count += fc.Count
+		total += (i + 1) * fc.Count
+	}
+	if stats.Ratings.Count > 0 {
+		stats.Ratings.Mean = float64(total) / float64(stats.Ratings.Count)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, statsQuery(`SELECT u.id, u.name, SUM(c.edits), COUNT(*)
+	FROM movie_contributions c
+	INNER JOIN matching m ON m.id = c.movie_id
+	INNER JOIN users u ON u.id = c.editor_id
+	GROUP BY u.id
+	ORDER BY 3 DESC, 1
+	LIMIT 10`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Contributor
+		if err := rows.Scan(&c.UserID, &c.Name, &c.Edits, &c.Movies); err != nil {
+			return nil, err
+		}
+		stats.Contributors = append(stats.Contributors, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Refresh recomputes the materialized views behind the statistics. They are
+// refreshed concurrently so the statistics can still be read meanwhile.
+func (m StatsModel) Refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, view := range statsViews {
+		_, err := m.DB.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY `+view)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -41,8 +41,8 @@ func generateToken(userID int, ttl time.Duration, scope string) (*Token, error)
 }
 
 func ValidateTokenPlainText(v *validator.Validator, tokenPlainText string) {
-	v.Check(tokenPlainText != "", "token", "token must be provided")
-	v.Check(len(tokenPlainText) == 26, "token", "token must be 26 bytes long")
+	v.Check(tokenPlainText != "", "token", validator.CodeRequired, "token must be provided")
+	v.Check(len(tokenPlainText) == 26, "token", validator.CodeInvalid, "token must be 26 bytes long")
 }
 
 type TokenModel struct {
@@ -62,19 +62,19 @@ func (u *User) IsAnonymous() bool {
 }
 
 func ValidateEmail(v *validator.Validator, email string) {
-	v.Check(email != "", "email", "email must be provided")
-	v.Check(validator.Matches(email, validator.EmailRX), "email", "email is invalid")
+	v.Check(email != "", "email", validator.CodeRequired, "email must be provided")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", validator.CodeInvalid, "email is invalid")
 }
 
 func ValidPlainText(v *validator.Validator, plaintext *string) {
-	v.Check(plaintext != nil, "password", "password cannot be null")
-	v.Check(*plaintext != "", "password", "password must be provided")
+	v.Check(plaintext != nil, "password", validator.CodeRequired, "password cannot be null")
+	v.Check(*plaintext != "", "password", validator.CodeRequired, "password must be provided")
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
 	// name validation
-	v.Check(user.Name != "", "name", "name must be provided")
-	v.Check(validator.MaxChars(user.Name, 500), "name", "name cannot be more than 500 characters")
+	v.Check(user.Name != "", "name", validator.CodeRequired, "name must be provided")
+	v.Check(validator.MaxChars(user.Name, 500), "name", validator.CodeTooLong, "name cannot be more than 500 characters")
 
 	// email validation
 	ValidateEmail(v, user.Email)
@@ -82,7 +82,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 	// password validation
 	ValidPlainText(v, user.Password.plaintext)
 
-	v.Check(validator.InBetween(*user.Password.plaintext, 8, 72), "password", "password length should be between 8 and 72")
+	v.Check(validator.InBetween(*user.Password.plaintext, 8, 72), "password", validator.CodeOutOfRange, "password length should be between 8 and 72")
 	if user.Password.hash == nil {
 		panic("missing password hash for user")
 	}
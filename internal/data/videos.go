@@ -0,0 +1,289 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"movies/internal/validator"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	VideoSiteYouTube = "youtube"
+	VideoSiteVimeo   = "vimeo"
+	VideoSiteSelf    = "self"
+)
+
+var (
+	VideoSites = []string{VideoSiteYouTube, VideoSiteVimeo, VideoSiteSelf}
+	VideoTypes = []string{"trailer", "teaser", "clip"}
+)
+
+type Video struct {
+	ID          int        `json:"id"`
+	MovieID     int        `json:"movie_id"`
+	Site        string     `json:"site"`
+	Key         string     `json:"key,omitempty"`
+	URL         string     `json:"url"`
+	Type        string     `json:"type"`
+	Language    string     `json:"language,omitempty"`
+	Official    bool       `json:"official"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	CreatedAt   time.Time  `json:"-"`
+	Version     int32      `json:"version"`
+}
+
+// ResolveKey fills in the site key from the URL, or the canonical URL from the
+// key, so YouTube and Vimeo videos always carry both.
+func (video *Video) ResolveKey() {
+	switch video.Site {
+	case VideoSiteYouTube:
+		if key, ok := validator.YouTubeKey(video.URL); ok {
+			video.Key = key
+		}
+		if validator.Matches(video.Key, validator.YouTubeKeyRX) {
+			video.URL = "https://www.youtube.com/watch?v=" + video.Key
+		}
+	case VideoSiteVimeo:
+		if key, ok := validator.VimeoKey(video.URL); ok {
+			video.Key = key
+		}
+		if validator.Matches(video.Key, validator.VimeoKeyRX) {
+			video.URL = "https://vimeo.com/" + video.Key
+		}
+	case VideoSiteSelf:
+		video.Key = ""
+	}
+}
+
+func ValidateVideo(v *validator.Validator, video *Video) {
+	v.Check(validator.In(video.Site, VideoSites...), "site", validator.CodeNotAllowed, "site must be one of youtube, vimeo or self")
+	v.Check(validator.In(video.Type, VideoTypes...), "type", validator.CodeNotAllowed, "type must be one of trailer, teaser or clip")
+
+	switch video.Site {
+	case VideoSiteYouTube:
+		v.Check(validator.Matches(video.Key, validator.YouTubeKeyRX), "key", validator.CodeInvalid, "a valid YouTube key or URL must be provided")
+	case VideoSiteVimeo:
+		v.Check(validator.Matches(video.Key, validator.VimeoKeyRX), "key", validator.CodeInvalid, "a valid Vimeo key or URL must be provided")
+	case VideoSiteSelf:
+		v.Check(video.URL != "", "url", validator.CodeRequired, "url must be provided")
+		v.Check(validator.IsURL(video.URL), "url", validator.CodeInvalid, "url must be an absolute http or https URL")
+		v.Check(validator.MaxChars(video.URL, 2048), "url", validator.CodeTooLong, "url should be less than or equal to 2048 characters long")
+	}
+
+	v.Check(video.Language == "" || validator.Matches(video.Language, validator.LanguageTagRX), "language", validator.CodeInvalid, "language must be a valid BCP 47 tag such as en or pt-BR")
+	v.Check(video.PublishedAt == nil || video.PublishedAt.Year() >= 1888, "published_at", validator.CodeOutOfRange, "published_at must not be before 1888")
+}
+
+type VideoModel struct {
+	DB *sql.DB
+}
+
+func (m VideoModel) Insert(video *Video) error {
+	query := `INSERT INTO movie_videos (movie_id, site, key, url, type, language, official, published_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, created_at, version`
+
+	args := []interface{}{
+		video.MovieID,
+		video.Site,
+		video.Key,
+		video.URL,
+		video.Type,
+		video.Language,
+		video.Official,
+		video.PublishedAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&video.ID, &video.CreatedAt, &video.Version)
+}
+
+func (m VideoModel) Get(movieID, id int) (*Video, error) {
+	if id < 1 {
+		return nil, ErrNoRecordFound
+	}
+
+	query := `SELECT id, movie_id, site, key, url, type, language, official, published_at, created_at, version
+	FROM movie_videos
+	WHERE id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var video Video
+
+	err := m.DB.QueryRowContext(ctx, query, id, movieID).Scan(
+		&video.ID,
+		&video.MovieID,
+		&video.Site,
+		&video.Key,
+		&video.URL,
+		&video.Type,
+		&video.Language,
+		&video.Official,
+		&video.PublishedAt,
+		&video.CreatedAt,
+		&video.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+	return &video, nil
+}
+
+func (m VideoModel) GetForMovie(movieID int) ([]*Video, error) {
+	query := `SELECT id, movie_id, site, key, url, type, language, official, published_at, created_at, version
+	FROM movie_videos
+	WHERE movie_id = $1
+	ORDER BY official DESC, published_at DESC NULLS LAST, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []*Video{}
+
+	for rows.Next() {
+		var video Video
+		err := rows.Scan(
+			&video.ID,
+			&video.MovieID,
+			&video.Site,
+			&video.Key,
+			&video.URL,
+			&video.Type,
+			&video.Language,
+			&video.Official,
+			&video.PublishedAt,
+			&video.CreatedAt,
+			&video.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, &video)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// GetOfficialTrailers returns the most recent official trailer of every movie,
+// preferring trailers in the given language.
+func (m VideoModel) GetOfficialTrailers(movieIDs []int, language string) (map[int]*Video, error) {
+	query := `SELECT DISTINCT ON (movie_id) id, movie_id, site, key, url, type, language, official, published_at, created_at, version
+	FROM movie_videos
+	WHERE movie_id = ANY($1) AND official AND type = 'trailer'
+	ORDER BY movie_id, (lower(language) = lower($2)) DESC, published_at DESC NULLS LAST, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs), language)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trailers := make(map[int]*Video)
+
+	for rows.Next() {
+		var video Video
+		err := rows.Scan(
+			&video.ID,
+			&video.MovieID,
+			&video.Site,
+			&video.Key,
+			&video.URL,
+			&video.Type,
+			&video.Language,
+			&video.Official,
+			&video.PublishedAt,
+			&video.CreatedAt,
+			&video.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		trailers[video.MovieID] = &video
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return trailers, nil
+}
+
+func (m VideoModel) Update(video *Video) error {
+	query := `UPDATE movie_videos
+	SET site = $1, key = $2, url = $3, type = $4, language = $5, official = $6, published_at = $7, version = version + 1
+	WHERE id = $8 AND movie_id = $9 AND version = $10
+	RETURNING version`
+
+	args := []interface{}{
+		video.Site,
+		video.Key,
+		video.URL,
+		video.Type,
+		video.Language,
+		video.Official,
+		video.PublishedAt,
+		video.ID,
+		video.MovieID,
+		video.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&video.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m VideoModel) Delete(movieID, id int) error {
+	if id < 1 {
+		return ErrNoRecordFound
+	}
+
+	query := `DELETE FROM movie_videos WHERE id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// impressionWeight is what a movie appearing in a list counts for,
+	// compared to a view of the movie itself.
+	impressionWeight = 0.1
+	// popularityHalfLife is the time after which a view counts for half as
+	// much in the popularity of a movie.
+	popularityHalfLife = 3 * 24 * time.Hour
+	// popularityHorizon is how far back views are taken into account.
+	popularityHorizon = 14 * 24 * time.Hour
+	// viewsRetention is how long the hourly view counts are kept.
+	viewsRetention = 30 * 24 * time.Hour
+)
+
+const (
+	TrendingDay  = "day"
+	TrendingWeek = "week"
+)
+
+var TrendingWindows = []string{TrendingDay, TrendingWeek}
+
+var trendingWindows = map[string]time.Duration{
+	TrendingDay:  24 * time.Hour,
+	TrendingWeek: 7 * 24 * time.Hour,
+}
+
+type TrendingMovie struct {
+	MovieID int     `json:"-"`
+	Score   float64 `json:"score"`
+}
+
+type ViewModel struct {
+	DB *sql.DB
+}
+
+// Record adds the views and list appearances counted since the last time to
+// the current hour. Counts of movies that have been deleted meanwhile are
+// dropped.
+func (m ViewModel) Record(views, impressions map[int]int) error {
+	counts := make(map[int][2]int, len(views))
+	for id, n := range views {
+		c := counts[id]
+		c[0] = n
+		counts[id] = c
+	}
+	for id, n := range impressions {
+		c := counts[id]
+		c[1] = n
+		counts[id] = c
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(counts))
+	viewCounts := make([]int64, 0, len(counts))
+	impressionCounts := make([]int64, 0, len(counts))
+	for id, c := range counts {
+		ids = append(ids, int64(id))
+		viewCounts = append(viewCounts, int64(c[0]))
+		impressionCounts = append(impressionCounts, int64(c[1]))
+	}
+
+	query := `INSERT INTO movie_views (movie_id, bucket, views, impressions)
+	SELECT c.movie_id, date_trunc('hour', NOW()), c.views, c.impressions
+	FROM unnest($1::bigint[], $2::integer[], $3::integer[]) AS c(movie_id, views, impressions)
+	INNER JOIN movies m ON m.id = c.movie_id
+	ON CONFLICT (movie_id, bucket) DO UPDATE
+	SET views = movie_views.views + EXCLUDED.views, impressions = movie_views.impressions + EXCLUDED.impressions`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(ids), pq.Array(viewCounts), pq.Array(impressionCounts))
+	return err
+}
+
+// decayedViews sums the views of every movie since $1 seconds ago, halving
+// their weight every $2 seconds.
+var decayedViews = fmt.Sprintf(`SELECT movie_id, SUM(
+		(views + impressions * %v) * power(0.5, extract(epoch FROM NOW() - bucket) / $2::float8)
+	) AS score
+	FROM movie_views
+	WHERE bucket > NOW() - make_interval(secs => $1::float8)
+	GROUP BY movie_id`, impressionWeight)
+
+// RefreshPopularity recomputes the popularity of the movies from their recent
+// views and forgets the views older than the retention.
+func (m ViewModel) RefreshPopularity() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE movies m SET popularity = s.score
+		FROM (
+			SELECT mv.id, COALESCE(v.score, 0) AS score
+			FROM movies mv
+			LEFT JOIN (`+decayedViews+`) v ON v.movie_id = mv.id
+			WHERE mv.popularity <> 0 OR v.movie_id IS NOT NULL
+		) s
+		WHERE m.id = s.id AND m.popularity IS DISTINCT FROM s.score::real`, popularityHorizon.Seconds(), popularityHalfLife.Seconds())
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM movie_views WHERE bucket < $1`, time.Now().Add(-viewsRetention))
+		return err
+	})
+}
+
+// Trending returns the movies viewed the most over the window, recent views
+// weighing more than older ones: their weight halves every quarter of the
+// window.
+func (m ViewModel) Trending(window string, limit int) ([]*TrendingMovie, error) {
+	duration, ok := trendingWindows[window]
+	if !ok {
+		panic("unknown trending window: " + window)
+	}
+
+	query := `SELECT v.movie_id, v.score
+	FROM (` + decayedViews + `) v
+	INNER JOIN movies m ON m.id = v.movie_id
+	WHERE m.deleted_at IS NULL
+	ORDER BY v.score DESC, v.movie_id
+	LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, duration.Seconds(), (duration / 4).Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trending := []*TrendingMovie{}
+
+	for rows.Next() {
+		var t TrendingMovie
+		err := rows.Scan(&t.MovieID, &t.Score)
+		if err != nil {
+			return nil, err
+		}
+		trending = append(trending, &t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return trending, nil
+}
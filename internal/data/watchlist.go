@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type WatchlistItem struct {
+	MovieID   int       `json:"movie_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+// Add puts a movie on the watchlist of a user. Adding a movie that is already
+// there keeps the date it was first added.
+func (m WatchlistModel) Add(userID, movieID int) (*WatchlistItem, error) {
+	query := `INSERT INTO watchlist_items (user_id, movie_id)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id, movie_id) DO UPDATE SET created_at = watchlist_items.created_at
+	RETURNING movie_id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var item WatchlistItem
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(&item.MovieID, &item.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (m WatchlistModel) Remove(userID, movieID int) error {
+	query := `DELETE FROM watchlist_items WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+	return nil
+}
+
+// GetAll returns the watchlist of a user, most recently added first. Movies in
+// the trash are left out.
+func (m WatchlistModel) GetAll(userID int) ([]*WatchlistItem, error) {
+	query := `SELECT w.movie_id, w.created_at
+	FROM watchlist_items w
+	INNER JOIN movies m ON m.id = w.movie_id
+	WHERE w.user_id = $1 AND m.deleted_at IS NULL
+	ORDER BY w.created_at DESC, w.movie_id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*WatchlistItem{}
+
+	for rows.Next() {
+		var item WatchlistItem
+		err := rows.Scan(&item.MovieID, &item.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,174 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+const maxPixels = 40_000_000
+
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Sizes are the resized variants generated for every upload, the original is
+// always kept as well. Images are never upscaled.
+var Sizes = []Size{
+	{Name: "small", Width: 185},
+	{Name: "medium", Width: 500},
+	{Name: "large", Width: 1280},
+}
+
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+type Result struct {
+	Format   string
+	Width    int
+	Height   int
+	Variants []Variant
+}
+
+func (r Result) ContentType() string {
+	return "image/" + r.Format
+}
+
+func (r Result) Extension() string {
+	if r.Format == FormatPNG {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// Process decodes a JPEG or PNG upload and re-encodes it into the original and
+// every size in Sizes. Re-encoding drops any EXIF, XMP or text chunks the upload
+// carried.
+func Process(data []byte) (*Result, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if format != FormatJPEG && format != FormatPNG {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	bounds := src.Bounds()
+	original := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(original, original.Bounds(), src, bounds.Min, draw.Src)
+
+	result := &Result{Format: format, Width: original.Rect.Dx(), Height: original.Rect.Dy()}
+
+	encoded, err := encode(original, format)
+	if err != nil {
+		return nil, err
+	}
+	result.Variants = append(result.Variants, Variant{Name: "original", Width: result.Width, Height: result.Height, Data: encoded})
+
+	for _, size := range Sizes {
+		resized := original
+		if size.Width < result.Width {
+			height := max(1, result.Height*size.Width/result.Width)
+			resized = resize(original, size.Width, height)
+		}
+
+		encoded, err := encode(resized, format)
+		if err != nil {
+			return nil, err
+		}
+		result.Variants = append(result.Variants, Variant{Name: size.Name, Width: resized.Rect.Dx(), Height: resized.Rect.Dy(), Data: encoded})
+	}
+
+	return result, nil
+}
+
+func encode(img *image.NRGBA, format string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	var err error
+	switch format {
+	case FormatPNG:
+		err = png.Encode(buf, img)
+	default:
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resize downscales src with an area-averaging filter, every source pixel
+// contributing to the destination pixels it overlaps in proportion to the overlap.
+func resize(src *image.NRGBA, width, height int) *image.NRGBA {
+	srcW, srcH := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	scaleX := float64(srcW) / float64(width)
+	scaleY := float64(srcH) / float64(height)
+
+	for y := 0; y < height; y++ {
+		y0 := float64(y) * scaleY
+		y1 := y0 + scaleY
+
+		for x := 0; x < width; x++ {
+			x0 := float64(x) * scaleX
+			x1 := x0 + scaleX
+
+			var r, g, b, a, total float64
+			for sy := int(y0); sy < srcH && float64(sy) < y1; sy++ {
+				wy := min(y1, float64(sy+1)) - max(y0, float64(sy))
+				row := src.Pix[sy*src.Stride:]
+
+				for sx := int(x0); sx < srcW && float64(sx) < x1; sx++ {
+					w := wy * (min(x1, float64(sx+1)) - max(x0, float64(sx)))
+					p := row[sx*4 : sx*4+4]
+					alpha := float64(p[3]) * w
+
+					r += float64(p[0]) * alpha
+					g += float64(p[1]) * alpha
+					b += float64(p[2]) * alpha
+					a += alpha
+					total += w
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			if a > 0 {
+				dst.Pix[i] = uint8(r/a + 0.5)
+				dst.Pix[i+1] = uint8(g/a + 0.5)
+				dst.Pix[i+2] = uint8(b/a + 0.5)
+			}
+			if total > 0 {
+				dst.Pix[i+3] = uint8(a/total + 0.5)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,51 @@
+// Package jsonpatch applies patches to JSON documents.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidPatch = errors.New("patch must be a JSON object")
+
+// MergePatch applies a JSON merge patch (RFC 7386) to doc and returns the
+// patched document.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if len(doc) > 0 {
+		if err := json.Unmarshal(doc, &target); err != nil {
+			return nil, err
+		}
+	}
+
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		return nil, ErrInvalidPatch
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+	return targetObject
+}
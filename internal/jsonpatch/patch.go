@@ -0,0 +1,320 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var ErrTestFailed = errors.New("test operation failed")
+
+// OperationError reports an operation of a JSON patch that could not be
+// applied.
+type OperationError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %s", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+type operation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// Apply applies a JSON patch (RFC 6902) to doc and returns the patched
+// document. Operations run in order and the first failing one stops the
+// patch, a failed test is reported as ErrTestFailed.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if len(doc) > 0 {
+		if err := json.Unmarshal(doc, &target); err != nil {
+			return nil, err
+		}
+	}
+
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, errors.New("patch must be a JSON array of operations")
+	}
+
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, &OperationError{i, op.Op, "", errors.New("path must be provided")}
+		}
+
+		var err error
+		target, err = applyOperation(target, op)
+		if err != nil {
+			return nil, &OperationError{i, op.Op, *op.Path, err}
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func applyOperation(doc interface{}, op operation) (interface{}, error) {
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("value must be provided")
+		}
+		if err := json.Unmarshal(*op.Value, &value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, errors.New("from must be provided")
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err = get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, errors.New("a value can't be moved into one of its children")
+			}
+			doc, err = remove(doc, from)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return add(doc, path, value)
+	case "remove":
+		return remove(doc, path)
+	case "replace":
+		if _, err := get(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		doc, err = remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "test":
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, errors.New("op must be one of add, remove, replace, move, copy or test")
+	}
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of bounds", i)
+	}
+	return i, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path not found at %q", token)
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at path and returns the updated document. Arrays are
+// rebuilt, so the parent of the changed node gets updated as well.
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token := path[0]
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		if len(path) == 1 {
+			i, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		i, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := add(node[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("path not found at %q", token)
+	}
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("the whole document can't be removed")
+	}
+
+	token := path[0]
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+		if len(path) == 1 {
+			delete(node, token)
+			return node, nil
+		}
+		child, err := remove(child, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			return append(node[:i], node[i+1:]...), nil
+		}
+		child, err := remove(node[i], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("path not found at %q", token)
+	}
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = deepCopy(value)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = deepCopy(value)
+		}
+		return c
+	default:
+		return value
+	}
+}
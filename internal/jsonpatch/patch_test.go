@@ -0,0 +1,268 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	// Most cases are the examples of RFC 6902 Appendix A.
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "add an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "add an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "add at the end of an array",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux"]}`,
+		},
+		{
+			name:  "remove an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "remove an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "replace a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "replace an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "replace", "path": "/foo/1", "value": "boo"}]`,
+			want:  `{"foo": ["bar", "boo", "baz"]}`,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "", "value": {"baz": "qux"}}]`,
+			want:  `{"baz": "qux"}`,
+		},
+		{
+			name:  "move a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "move an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:  "copy a value",
+			doc:   `{"foo": {"bar": [1, 2]}}`,
+			patch: `[{"op": "copy", "from": "/foo/bar", "path": "/baz"}, {"op": "add", "path": "/baz/-", "value": 3}]`,
+			want:  `{"foo": {"bar": [1, 2]}, "baz": [1, 2, 3]}`,
+		},
+		{
+			name: "test succeeds",
+			doc:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[
+				{"op": "test", "path": "/baz", "value": "qux"},
+				{"op": "test", "path": "/foo/1", "value": 2}
+			]`,
+			want: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:  "add a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "ignore unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name: "escape ordering",
+			doc:  `{"/": 9, "~1": 10}`,
+			patch: `[
+				{"op": "test", "path": "/~01", "value": 10},
+				{"op": "test", "path": "/~1", "value": 9}
+			]`,
+			want: `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:  "add an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if !equalJSON(t, got, []byte(tt.want)) {
+				t.Errorf("Apply = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		index   int
+		wantErr error
+	}{
+		{
+			name:    "test fails",
+			doc:     `{"baz": "qux"}`,
+			patch:   `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:    "test compares strings and numbers",
+			doc:     `{"/": 9, "~1": 10}`,
+			patch:   `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:  "add to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+		},
+		{
+			name:  "remove a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+		},
+		{
+			name:  "replace a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "qux"}]`,
+		},
+		{
+			name:  "array index out of bounds",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/2", "value": "qux"}]`,
+		},
+		{
+			name:  "array index with a leading zero",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/01"}]`,
+		},
+		{
+			name:  "end of an array outside of add",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "remove", "path": "/foo/-"}]`,
+		},
+		{
+			name:  "move into a child",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo/baz"}]`,
+		},
+		{
+			name:  "unknown operation",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "merge", "path": "/foo", "value": "qux"}]`,
+		},
+		{
+			name:  "missing value",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz"}]`,
+		},
+		{
+			name:  "invalid pointer",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "baz", "value": "qux"}]`,
+		},
+		{
+			name: "failing operation after others",
+			doc:  `{"foo": "bar"}`,
+			patch: `[
+				{"op": "add", "path": "/baz", "value": "qux"},
+				{"op": "remove", "path": "/foo"},
+				{"op": "test", "path": "/baz", "value": "quux"}
+			]`,
+			index:   2,
+			wantErr: ErrTestFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := []byte(tt.doc)
+
+			got, err := Apply(doc, []byte(tt.patch))
+			if err == nil {
+				t.Fatalf("Apply = %s, want an error", got)
+			}
+			if got != nil {
+				t.Errorf("Apply returned %s along with an error", got)
+			}
+
+			var opErr *OperationError
+			if !errors.As(err, &opErr) {
+				t.Fatalf("Apply: got %v, want an OperationError", err)
+			}
+			if opErr.Index != tt.index {
+				t.Errorf("failing operation index = %d, want %d", opErr.Index, tt.index)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Apply: got %v, want %v", err, tt.wantErr)
+			}
+
+			// a failed patch leaves the document as it was
+			if string(doc) != tt.doc {
+				t.Errorf("document changed to %s", doc)
+			}
+		})
+	}
+}
+
+func TestApplyInvalidPatch(t *testing.T) {
+	for _, patch := range []string{`{"op": "add"}`, `not json`, `[{"op": "add", "value": 1}]`} {
+		if _, err := Apply([]byte(`{}`), []byte(patch)); err == nil {
+			t.Errorf("Apply(%s): want an error", patch)
+		}
+	}
+}
+
+func equalJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
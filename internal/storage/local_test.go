@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readObject(t *testing.T, s Storage, key string) string {
+	t.Helper()
+
+	object, err := s.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatalf("reading %q: %v", key, err)
+	}
+	return string(data)
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	s, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "images/ab/abcdef/original.jpg"
+
+	if err := s.Put(ctx, key, []byte("first"), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := readObject(t, s, key); got != "first" {
+		t.Errorf("Get = %q, want %q", got, "first")
+	}
+	if _, err := os.Stat(filepath.Join(root, "images", "ab", "abcdef", "original.jpg")); err != nil {
+		t.Errorf("object not stored under the root: %v", err)
+	}
+
+	if err := s.Put(ctx, key, []byte("second"), "image/jpeg"); err != nil {
+		t.Fatalf("Put over an existing object: %v", err)
+	}
+	if got := readObject(t, s, key); got != "second" {
+		t.Errorf("Get after overwrite = %q, want %q", got, "second")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "images", "ab", "abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %d entries", len(entries))
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestLocalInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "images/../../outside", "images//x", "images/./x", `images\x`} {
+		if err := s.Put(ctx, key, []byte("x"), ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): got %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := s.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q): got %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q): got %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
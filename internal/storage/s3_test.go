@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	fakeAccessKey = "AKIDEXAMPLE"
+	fakeSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	fakeRegion    = "us-east-1"
+	fakeBucket    = "movies"
+)
+
+// fakeS3 is an in-memory stand-in for an S3 bucket. It checks the Signature
+// Version 4 of every request against what it received, so a request signed
+// over anything else than what was sent is refused like S3 would.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	fake := &fakeS3{objects: make(map[string]fakeObject)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !validSignature(r, body) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = fakeObject{data: body, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) object(key string) (fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	object, ok := f.objects["/"+fakeBucket+"/"+key]
+	return object, ok
+}
+
+// validSignature recomputes the signature of the request from what the server
+// received.
+func validSignature(r *http.Request, body []byte) bool {
+	auth := r.Header.Get("Authorization")
+	prefix := "AWS4-HMAC-SHA256 Credential=" + fakeAccessKey + "/"
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	parts := strings.Split(strings.TrimPrefix(auth, prefix), ", ")
+	if len(parts) != 3 {
+		return false
+	}
+	scope := parts[0]
+	signedHeaders := strings.TrimPrefix(parts[1], "SignedHeaders=")
+	signature := strings.TrimPrefix(parts[2], "Signature=")
+
+	payloadHash := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(payloadHash[:]) {
+		return false
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		r.Header.Get("X-Amz-Date"),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	scopeParts := strings.Split(scope, "/")
+	if len(scopeParts) != 4 || scopeParts[1] != fakeRegion || scopeParts[2] != "s3" || scopeParts[3] != "aws4_request" {
+		return false
+	}
+
+	key := []byte("AWS4" + fakeSecretKey)
+	for _, part := range []string{scopeParts[0], fakeRegion, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return hmac.Equal([]byte(hex.EncodeToString(key)), []byte(signature))
+}
+
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	fake, server := newFakeS3(t)
+
+	s, err := NewS3(server.URL, fakeRegion, fakeBucket, fakeAccessKey, fakeSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"images/ab/abcdef/original.jpg", "images/ab/with space+plus/w342.png"} {
+		if err := s.Put(ctx, key, []byte("image data"), "image/png"); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+		object, ok := fake.object(key)
+		if !ok {
+			t.Fatalf("Put(%q) didn't store the object in the bucket", key)
+		}
+		if object.contentType != "image/png" {
+			t.Errorf("Put(%q) stored content type %q, want image/png", key, object.contentType)
+		}
+
+		if got := readObject(t, s, key); got != "image data" {
+			t.Errorf("Get(%q) = %q, want %q", key, got, "image data")
+		}
+
+		if err := s.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete(%q): %v", key, err)
+		}
+		if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) after Delete: got %v, want ErrNotFound", key, err)
+		}
+		if err := s.Delete(ctx, key); err != nil {
+			t.Errorf("Delete(%q) of a missing object: %v", key, err)
+		}
+	}
+}
+
+func TestS3WrongCredentials(t *testing.T) {
+	ctx := context.Background()
+	_, server := newFakeS3(t)
+
+	s, err := NewS3(server.URL, fakeRegion, fakeBucket, fakeAccessKey, "not the secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Put(ctx, "images/x.jpg", []byte("x"), "image/jpeg")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put with a wrong secret: got %v, want a 403 error", err)
+	}
+	if _, err := s.Get(ctx, "images/x.jpg"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get with a wrong secret: got %v, want a 403 error", err)
+	}
+}
+
+func TestS3InvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	_, server := newFakeS3(t)
+
+	s, err := NewS3(server.URL, fakeRegion, fakeBucket, fakeAccessKey, fakeSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "/x", "../x", "a//b"} {
+		if err := s.Put(ctx, key, []byte("x"), ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): got %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestNewS3(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		bucket   string
+		valid    bool
+	}{
+		{"http://localhost:9000", "movies", true},
+		{"localhost:9000", "movies", false},
+		{"http://localhost:9000", "", false},
+	}
+
+	for _, tt := range tests {
+		_, err := NewS3(tt.endpoint, fakeRegion, tt.bucket, fakeAccessKey, fakeSecretKey)
+		if (err == nil) != tt.valid {
+			t.Errorf("NewS3(%q, %q): got error %v, want valid %v", tt.endpoint, tt.bucket, err, tt.valid)
+		}
+	}
+}
@@ -2,37 +2,86 @@ package validator
 
 import (
 	"regexp"
+	"sort"
 	"unicode/utf8"
 )
 
 var (
-	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zAZ0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	EmailRX       = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zAZ0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	CountryRX     = regexp.MustCompile("^[A-Z]{2}$")
+	LanguageTagRX = regexp.MustCompile("^[a-zA-Z]{2,3}(-[a-zA-Z]{4})?(-(?:[a-zA-Z]{2}|[0-9]{3}))?$")
+	IMDbIDRX      = regexp.MustCompile("^tt[0-9]{7,10}$")
+	TMDbIDRX      = regexp.MustCompile("^[1-9][0-9]{0,9}$")
+	WikidataIDRX  = regexp.MustCompile("^Q[1-9][0-9]*$")
+)
+
+var ExternalIDProviders = map[string]*regexp.Regexp{
+	"imdb":     IMDbIDRX,
+	"tmdb":     TMDbIDRX,
+	"wikidata": WikidataIDRX,
+}
+
+// Codes identify why a field is invalid, they are stable so clients can
+// branch on them while the messages are free to change.
+const (
+	CodeRequired   = "required"
+	CodeTooLong    = "too_long"
+	CodeTooShort   = "too_short"
+	CodeNotUnique  = "not_unique"
+	CodeInvalid    = "invalid"
+	CodeOutOfRange = "out_of_range"
+	CodeNotAllowed = "not_allowed"
+	CodeConflict   = "conflict"
 )
 
 type Validator struct {
 	Errors map[string]string
+	Codes  map[string]string
+}
+
+// FieldError is the error of a single field, with its code.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{Errors: make(map[string]string), Codes: make(map[string]string)}
 }
 
 func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-func (v *Validator) AddError(key, message string) {
+func (v *Validator) AddError(key, code, message string) {
 	if _, exists := v.Errors[key]; !exists {
 		v.Errors[key] = message
+		v.Codes[key] = code
 	}
 }
 
-func (v *Validator) Check(ok bool, key, message string) {
+func (v *Validator) Check(ok bool, key, code, message string) {
 	if !ok {
-		v.AddError(key, message)
+		v.AddError(key, code, message)
 	}
 }
 
+// FieldErrors returns the errors sorted by field.
+func (v *Validator) FieldErrors() []FieldError {
+	fields := make([]string, 0, len(v.Errors))
+	for field := range v.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	errors := make([]FieldError, len(fields))
+	for i, field := range fields {
+		errors[i] = FieldError{Field: field, Code: v.Codes[field], Message: v.Errors[field]}
+	}
+	return errors
+}
+
 func In[T comparable](value T, list ...T) bool {
 	for _, item := range list {
 		if item == value {
@@ -55,6 +104,11 @@ func Unique[T comparable](values []T) bool {
 	return len(values) == len(uniqueValues)
 }
 
+func ExternalID(provider, value string) bool {
+	rx, ok := ExternalIDProviders[provider]
+	return ok && rx.MatchString(value)
+}
+
 func MaxChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) <= n
 }
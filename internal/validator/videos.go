@@ -0,0 +1,71 @@
+package validator
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	YouTubeKeyRX = regexp.MustCompile("^[A-Za-z0-9_-]{11}$")
+	VimeoKeyRX   = regexp.MustCompile("^[0-9]{6,12}$")
+)
+
+func IsURL(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// YouTubeKey extracts the video key from the watch, short, embed and youtu.be
+// forms of a YouTube URL.
+func YouTubeKey(value string) (string, bool) {
+	u, err := url.Parse(value)
+	if err != nil || !IsURL(value) {
+		return "", false
+	}
+
+	host := strings.TrimPrefix(strings.TrimPrefix(u.Hostname(), "www."), "m.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	var key string
+	switch host {
+	case "youtu.be":
+		key = segments[0]
+	case "youtube.com", "youtube-nocookie.com":
+		switch {
+		case len(segments) == 1 && segments[0] == "watch":
+			key = u.Query().Get("v")
+		case len(segments) == 2 && In(segments[0], "embed", "shorts", "v", "live"):
+			key = segments[1]
+		}
+	}
+
+	if !Matches(key, YouTubeKeyRX) {
+		return "", false
+	}
+	return key, true
+}
+
+// VimeoKey extracts the numeric video id from vimeo.com and player.vimeo.com URLs.
+func VimeoKey(value string) (string, bool) {
+	u, err := url.Parse(value)
+	if err != nil || !IsURL(value) {
+		return "", false
+	}
+
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	if host != "vimeo.com" && host != "player.vimeo.com" {
+		return "", false
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	key := segments[len(segments)-1]
+
+	if !Matches(key, VimeoKeyRX) {
+		return "", false
+	}
+	return key, true
+}
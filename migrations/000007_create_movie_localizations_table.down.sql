@@ -0,0 +1 @@
+DROP TABLE IF EXISTS movie_localizations;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS movie_localizations (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    language text NOT NULL,
+    title text NOT NULL,
+    tagline text NOT NULL DEFAULT '',
+    overview text NOT NULL DEFAULT '',
+    is_original bool NOT NULL DEFAULT false,
+    PRIMARY KEY (movie_id, language)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_localizations_original_idx ON movie_localizations (movie_id) WHERE is_original;
+
+CREATE INDEX IF NOT EXISTS movie_localizations_title_idx ON movie_localizations USING GIN (to_tsvector('simple', title));
\ No newline at end of file
@@ -0,0 +1,24 @@
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_year_check;
+
+ALTER TABLE movies ADD CONSTRAINT movies_year_check CHECK (year >= 1888);
+
+CREATE TABLE IF NOT EXISTS movie_releases (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    country text NOT NULL,
+    type text NOT NULL,
+    release_date date NOT NULL,
+    note text NOT NULL DEFAULT '',
+    UNIQUE (movie_id, country, type),
+    CONSTRAINT movie_releases_type_check CHECK (type IN ('theatrical', 'digital', 'physical', 'tv'))
+);
+
+CREATE INDEX IF NOT EXISTS movie_releases_date_idx ON movie_releases (release_date, country);
+
+CREATE TABLE IF NOT EXISTS movie_certifications (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    system text NOT NULL,
+    country text NOT NULL,
+    rating text NOT NULL,
+    PRIMARY KEY (movie_id, system)
+);
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS movie_images (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    kind text NOT NULL,
+    content_type text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    checksum text NOT NULL,
+    variants text[] NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT movie_images_kind_check CHECK (kind IN ('poster', 'still'))
+);
+
+CREATE INDEX IF NOT EXISTS movie_images_movie_idx ON movie_images (movie_id);
+
+CREATE INDEX IF NOT EXISTS movie_images_checksum_idx ON movie_images (checksum);
\ No newline at end of file
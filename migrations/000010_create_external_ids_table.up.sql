@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS external_ids (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    provider text NOT NULL,
+    value text NOT NULL,
+    PRIMARY KEY (movie_id, provider),
+    CONSTRAINT external_ids_provider_value_key UNIQUE (provider, value),
+    CONSTRAINT external_ids_provider_check CHECK (provider IN ('imdb', 'tmdb', 'wikidata'))
+);
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS movie_videos (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    site text NOT NULL,
+    key text NOT NULL DEFAULT '',
+    url text NOT NULL,
+    type text NOT NULL,
+    language text NOT NULL DEFAULT '',
+    official bool NOT NULL DEFAULT false,
+    published_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT movie_videos_site_check CHECK (site IN ('youtube', 'vimeo', 'self')),
+    CONSTRAINT movie_videos_type_check CHECK (type IN ('trailer', 'teaser', 'clip'))
+);
+
+CREATE INDEX IF NOT EXISTS movie_videos_movie_idx ON movie_videos (movie_id);
\ No newline at end of file
@@ -0,0 +1,61 @@
+CREATE OR REPLACE FUNCTION movie_snapshot(movie_id bigint) RETURNS jsonb AS $$
+    SELECT jsonb_build_object(
+        'id', m.id,
+        'title', m.title,
+        'year', m.year,
+        'runtime', m.runtime,
+        'genres', to_jsonb(m.genres),
+        'version', m.version,
+        'localizations', COALESCE((
+            SELECT jsonb_agg(jsonb_build_object(
+                'language', l.language,
+                'title', l.title,
+                'tagline', l.tagline,
+                'overview', l.overview,
+                'is_original', l.is_original
+            ) ORDER BY l.language)
+            FROM movie_localizations l WHERE l.movie_id = m.id
+        ), '[]'::jsonb),
+        'releases', COALESCE((
+            SELECT jsonb_agg(jsonb_build_object(
+                'country', r.country,
+                'type', r.type,
+                'release_date', to_char(r.release_date, 'YYYY-MM-DD'),
+                'note', r.note
+            ) ORDER BY r.release_date, r.country, r.type)
+            FROM movie_releases r WHERE r.movie_id = m.id
+        ), '[]'::jsonb),
+        'certifications', COALESCE((
+            SELECT jsonb_agg(jsonb_build_object(
+                'system', c.system,
+                'country', c.country,
+                'rating', c.rating
+            ) ORDER BY c.system)
+            FROM movie_certifications c WHERE c.movie_id = m.id
+        ), '[]'::jsonb),
+        'external_ids', COALESCE((
+            SELECT jsonb_object_agg(e.provider, e.value)
+            FROM external_ids e WHERE e.movie_id = m.id
+        ), '{}'::jsonb)
+    )
+    FROM movies m
+    WHERE m.id = movie_snapshot.movie_id
+$$ LANGUAGE sql STABLE;
+
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL,
+    version integer NOT NULL,
+    action text NOT NULL,
+    snapshot jsonb NOT NULL,
+    editor_id bigint REFERENCES users ON DELETE SET NULL,
+    restored_from integer,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT movie_revisions_movie_version_key UNIQUE (movie_id, version),
+    CONSTRAINT movie_revisions_action_check CHECK (action IN ('create', 'update', 'restore', 'delete'))
+);
+
+-- Seed the history with the current state of every existing movie.
+INSERT INTO movie_revisions (movie_id, version, action, snapshot, created_at)
+SELECT id, version, 'create', movie_snapshot(id), created_at
+FROM movies;
\ No newline at end of file
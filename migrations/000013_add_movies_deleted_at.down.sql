@@ -0,0 +1,14 @@
+DELETE FROM permissions WHERE code = 'movies:purge';
+
+DELETE FROM movie_revisions WHERE action IN ('undelete', 'purge');
+
+ALTER TABLE movie_revisions DROP CONSTRAINT IF EXISTS movie_revisions_action_check;
+
+ALTER TABLE movie_revisions ADD CONSTRAINT movie_revisions_action_check CHECK (action IN ('create', 'update', 'restore', 'delete'));
+
+-- Movies in the trash were deleted, they mustn't come back once the column is gone.
+DELETE FROM movies WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS movies_deleted_at_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS deleted_at;
\ No newline at end of file
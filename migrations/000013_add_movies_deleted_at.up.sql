@@ -0,0 +1,11 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS movies_deleted_at_idx ON movies (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE movie_revisions DROP CONSTRAINT IF EXISTS movie_revisions_action_check;
+
+ALTER TABLE movie_revisions ADD CONSTRAINT movie_revisions_action_check CHECK (action IN ('create', 'update', 'restore', 'delete', 'undelete', 'purge'));
+
+INSERT INTO permissions (code)
+VALUES
+('movies:purge');
\ No newline at end of file
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'movies:moderate';
+
+DROP TABLE IF EXISTS edit_proposals;
\ No newline at end of file
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS edit_proposals (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    author_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    base_version integer NOT NULL,
+    patch jsonb NOT NULL,
+    rationale text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    moderator_id bigint REFERENCES users ON DELETE SET NULL,
+    moderator_note text NOT NULL DEFAULT '',
+    applied_version integer,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT edit_proposals_status_check CHECK (status IN ('pending', 'approved', 'rejected', 'changes_requested')),
+    CONSTRAINT edit_proposals_patch_check CHECK (jsonb_typeof(patch) = 'object')
+);
+
+CREATE INDEX IF NOT EXISTS edit_proposals_status_idx ON edit_proposals (status, created_at);
+
+CREATE INDEX IF NOT EXISTS edit_proposals_movie_id_idx ON edit_proposals (movie_id);
+
+INSERT INTO permissions (code)
+VALUES
+('movies:moderate');
\ No newline at end of file
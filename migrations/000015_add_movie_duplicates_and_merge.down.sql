@@ -0,0 +1,13 @@
+DELETE FROM permissions WHERE code = 'movies:merge';
+
+DELETE FROM movie_revisions WHERE action = 'merge';
+
+ALTER TABLE movie_revisions DROP CONSTRAINT IF EXISTS movie_revisions_action_check;
+
+ALTER TABLE movie_revisions ADD CONSTRAINT movie_revisions_action_check CHECK (action IN ('create', 'update', 'restore', 'delete', 'undelete', 'purge'));
+
+DROP TABLE IF EXISTS movie_redirects;
+
+DROP INDEX IF EXISTS movies_title_normalized_trgm_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS title_normalized;
\ No newline at end of file
@@ -0,0 +1,22 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS title_normalized text
+    GENERATED ALWAYS AS (btrim(regexp_replace(lower(title), '[^[:alnum:]]+', ' ', 'g'))) STORED;
+
+CREATE INDEX IF NOT EXISTS movies_title_normalized_trgm_idx ON movies USING GIN (title_normalized gin_trgm_ops);
+
+CREATE TABLE IF NOT EXISTS movie_redirects (
+    from_id bigint PRIMARY KEY,
+    to_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS movie_redirects_to_id_idx ON movie_redirects (to_id);
+
+ALTER TABLE movie_revisions DROP CONSTRAINT IF EXISTS movie_revisions_action_check;
+
+ALTER TABLE movie_revisions ADD CONSTRAINT movie_revisions_action_check CHECK (action IN ('create', 'update', 'restore', 'delete', 'undelete', 'purge', 'merge'));
+
+INSERT INTO permissions (code)
+VALUES
+('movies:merge');
\ No newline at end of file
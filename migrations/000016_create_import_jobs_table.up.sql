@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    format text NOT NULL,
+    dry_run bool NOT NULL DEFAULT false,
+    upsert bool NOT NULL DEFAULT false,
+    status text NOT NULL DEFAULT 'pending',
+    total_rows integer NOT NULL DEFAULT 0,
+    inserted integer NOT NULL DEFAULT 0,
+    updated integer NOT NULL DEFAULT 0,
+    failed integer NOT NULL DEFAULT 0,
+    errors jsonb NOT NULL DEFAULT '[]',
+    error text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) with time zone,
+    CONSTRAINT import_jobs_format_check CHECK (format IN ('csv', 'ndjson')),
+    CONSTRAINT import_jobs_status_check CHECK (status IN ('pending', 'running', 'completed', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS import_jobs_user_id_idx ON import_jobs (user_id);
\ No newline at end of file
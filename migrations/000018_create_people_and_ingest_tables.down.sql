@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS ingest_title_principals;
+
+DROP TABLE IF EXISTS ingest_name_basics;
+
+DROP TABLE IF EXISTS ingest_title_basics;
+
+DROP TABLE IF EXISTS ingest_checkpoints;
+
+DROP TABLE IF EXISTS movie_credits;
+
+DROP TABLE IF EXISTS people;
\ No newline at end of file
@@ -0,0 +1,57 @@
+CREATE TABLE IF NOT EXISTS people (
+    id bigserial PRIMARY KEY,
+    imdb_id text UNIQUE,
+    name text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS movie_credits (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    person_id bigint NOT NULL REFERENCES people ON DELETE CASCADE,
+    category text NOT NULL,
+    job text NOT NULL DEFAULT '',
+    characters text[] NOT NULL DEFAULT '{}',
+    ordering integer NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS movie_credits_movie_id_idx ON movie_credits (movie_id, ordering);
+
+CREATE INDEX IF NOT EXISTS movie_credits_person_id_idx ON movie_credits (person_id);
+
+CREATE TABLE IF NOT EXISTS ingest_checkpoints (
+    stage text PRIMARY KEY,
+    file_name text NOT NULL,
+    file_size bigint NOT NULL,
+    file_modified timestamp(0) with time zone NOT NULL,
+    loaded bool NOT NULL DEFAULT false,
+    completed bool NOT NULL DEFAULT false,
+    last_key text NOT NULL DEFAULT '',
+    inserted bigint NOT NULL DEFAULT 0,
+    updated bigint NOT NULL DEFAULT 0,
+    skipped bigint NOT NULL DEFAULT 0,
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS ingest_title_basics (
+    tconst text PRIMARY KEY,
+    title text NOT NULL,
+    year integer NOT NULL,
+    runtime integer NOT NULL,
+    genres text[] NOT NULL
+);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS ingest_name_basics (
+    nconst text PRIMARY KEY,
+    name text NOT NULL
+);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS ingest_title_principals (
+    tconst text NOT NULL,
+    ordering integer NOT NULL,
+    nconst text NOT NULL,
+    category text NOT NULL,
+    job text NOT NULL,
+    characters text[] NOT NULL,
+    PRIMARY KEY (tconst, ordering)
+);
\ No newline at end of file
@@ -0,0 +1,33 @@
+DROP TRIGGER IF EXISTS people_search_vector_update ON people;
+
+DROP FUNCTION IF EXISTS people_search_vector_trigger();
+
+DROP TRIGGER IF EXISTS movie_credits_search_vector_delete ON movie_credits;
+
+DROP TRIGGER IF EXISTS movie_credits_search_vector_update ON movie_credits;
+
+DROP TRIGGER IF EXISTS movie_credits_search_vector_insert ON movie_credits;
+
+DROP TRIGGER IF EXISTS movie_localizations_search_vector_delete ON movie_localizations;
+
+DROP TRIGGER IF EXISTS movie_localizations_search_vector_update ON movie_localizations;
+
+DROP TRIGGER IF EXISTS movie_localizations_search_vector_insert ON movie_localizations;
+
+DROP FUNCTION IF EXISTS movie_relations_search_vector_update_trigger();
+
+DROP FUNCTION IF EXISTS movie_relations_search_vector_trigger();
+
+DROP TRIGGER IF EXISTS movies_search_vector_update ON movies;
+
+DROP FUNCTION IF EXISTS movies_search_vector_trigger();
+
+DROP INDEX IF EXISTS movies_search_vector_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS search_vector;
+
+DROP FUNCTION IF EXISTS movie_search_vector(bigint, text);
+
+DROP AGGREGATE IF EXISTS tsvector_agg(tsvector);
+
+DROP FUNCTION IF EXISTS search_config(text);
\ No newline at end of file
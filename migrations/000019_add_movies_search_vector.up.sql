@@ -0,0 +1,123 @@
+CREATE OR REPLACE FUNCTION search_config(language text) RETURNS regconfig AS $$
+    SELECT (CASE lower(split_part(language, '-', 1))
+        WHEN 'da' THEN 'danish'
+        WHEN 'de' THEN 'german'
+        WHEN 'en' THEN 'english'
+        WHEN 'es' THEN 'spanish'
+        WHEN 'fi' THEN 'finnish'
+        WHEN 'fr' THEN 'french'
+        WHEN 'hu' THEN 'hungarian'
+        WHEN 'it' THEN 'italian'
+        WHEN 'nb' THEN 'norwegian'
+        WHEN 'nl' THEN 'dutch'
+        WHEN 'no' THEN 'norwegian'
+        WHEN 'pt' THEN 'portuguese'
+        WHEN 'ro' THEN 'romanian'
+        WHEN 'ru' THEN 'russian'
+        WHEN 'sv' THEN 'swedish'
+        WHEN 'tr' THEN 'turkish'
+        ELSE 'simple'
+    END)::regconfig
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE AGGREGATE tsvector_agg(tsvector) (
+    SFUNC = tsvector_concat,
+    STYPE = tsvector,
+    INITCOND = ''
+);
+
+-- Titles weigh the most, then the people credited, then taglines and overviews.
+-- Localized text is indexed with the configuration of its language so it is
+-- stemmed, the stored title with the simple one.
+CREATE OR REPLACE FUNCTION movie_search_vector(movie_id bigint, title text) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('simple', COALESCE($2, '')), 'A')
+        || COALESCE((
+            SELECT tsvector_agg(
+                setweight(to_tsvector(search_config(l.language), l.title), 'A')
+                || setweight(to_tsvector(search_config(l.language), l.tagline || ' ' || l.overview), 'C')
+            )
+            FROM movie_localizations l WHERE l.movie_id = $1
+        ), '')
+        || setweight(to_tsvector('simple', COALESCE((
+            SELECT string_agg(p.name, ' ')
+            FROM movie_credits c
+            INNER JOIN people p ON p.id = c.person_id
+            WHERE c.movie_id = $1
+        ), '')), 'B')
+$$ LANGUAGE sql STABLE;
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS search_vector tsvector NOT NULL DEFAULT '';
+
+UPDATE movies SET search_vector = movie_search_vector(id, title);
+
+CREATE INDEX IF NOT EXISTS movies_search_vector_idx ON movies USING GIN (search_vector);
+
+CREATE OR REPLACE FUNCTION movies_search_vector_trigger() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := movie_search_vector(NEW.id, NEW.title);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movies_search_vector_update
+    BEFORE INSERT OR UPDATE OF title ON movies
+    FOR EACH ROW EXECUTE FUNCTION movies_search_vector_trigger();
+
+-- Changes to localizations and credits refresh the vector of the movies they
+-- belong to once per statement, so bulk loads don't rebuild a movie per row.
+CREATE OR REPLACE FUNCTION movie_relations_search_vector_trigger() RETURNS trigger AS $$
+BEGIN
+    UPDATE movies SET search_vector = movie_search_vector(movies.id, movies.title)
+    WHERE movies.id IN (SELECT movie_id FROM changed_rows);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+-- Updates can move rows to another movie, so both the movies they left and the
+-- ones they moved to are refreshed.
+CREATE OR REPLACE FUNCTION movie_relations_search_vector_update_trigger() RETURNS trigger AS $$
+BEGIN
+    UPDATE movies SET search_vector = movie_search_vector(movies.id, movies.title)
+    WHERE movies.id IN (SELECT movie_id FROM old_rows UNION SELECT movie_id FROM new_rows);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER movie_localizations_search_vector_insert
+    AFTER INSERT ON movie_localizations REFERENCING NEW TABLE AS changed_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION movie_relations_search_vector_trigger();
+
+CREATE TRIGGER movie_localizations_search_vector_update
+    AFTER UPDATE ON movie_localizations REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION movie_relations_search_vector_update_trigger();
+
+CREATE TRIGGER movie_localizations_search_vector_delete
+    AFTER DELETE ON movie_localizations REFERENCING OLD TABLE AS changed_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION movie_relations_search_vector_trigger();
+
+CREATE TRIGGER movie_credits_search_vector_insert
+    AFTER INSERT ON movie_credits REFERENCING NEW TABLE AS changed_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION movie_relations_search_vector_trigger();
+
+CREATE TRIGGER movie_credits_search_vector_update
+    AFTER UPDATE ON movie_credits REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION movie_relations_search_vector_update_trigger();
+
+CREATE TRIGGER movie_credits_search_vector_delete
+    AFTER DELETE ON movie_credits REFERENCING OLD TABLE AS changed_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION movie_relations_search_vector_trigger();
+
+CREATE OR REPLACE FUNCTION people_search_vector_trigger() RETURNS trigger AS $$
+BEGIN
+    UPDATE movies SET search_vector = movie_search_vector(movies.id, movies.title)
+    WHERE movies.id IN (
+        SELECT c.movie_id FROM movie_credits c
+        INNER JOIN changed_rows p ON p.id = c.person_id
+    );
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER people_search_vector_update
+    AFTER UPDATE OF name ON people REFERENCING NEW TABLE AS changed_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION people_search_vector_trigger();
\ No newline at end of file
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS movies_title_normalized_prefix_idx;
+
+DROP INDEX IF EXISTS people_name_normalized_prefix_idx;
+
+DROP INDEX IF EXISTS people_name_normalized_trgm_idx;
+
+ALTER TABLE people DROP COLUMN IF EXISTS name_normalized;
\ No newline at end of file
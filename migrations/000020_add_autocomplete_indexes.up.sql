@@ -0,0 +1,8 @@
+ALTER TABLE people ADD COLUMN IF NOT EXISTS name_normalized text
+    GENERATED ALWAYS AS (btrim(regexp_replace(lower(name), '[^[:alnum:]]+', ' ', 'g'))) STORED;
+
+CREATE INDEX IF NOT EXISTS people_name_normalized_trgm_idx ON people USING GIN (name_normalized gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS people_name_normalized_prefix_idx ON people (name_normalized text_pattern_ops);
+
+CREATE INDEX IF NOT EXISTS movies_title_normalized_prefix_idx ON movies (title_normalized text_pattern_ops);
\ No newline at end of file
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS similar_movies_refreshes;
+
+DROP TABLE IF EXISTS similar_movies;
+
+DROP FUNCTION IF EXISTS array_jaccard(text[], text[]);
+
+DROP VIEW IF EXISTS movie_likes;
+
+DROP TABLE IF EXISTS watchlist_items;
+
+DROP TABLE IF EXISTS movie_ratings;
\ No newline at end of file
@@ -0,0 +1,55 @@
+CREATE TABLE IF NOT EXISTS movie_ratings (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    score smallint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, movie_id),
+    CONSTRAINT movie_ratings_score_check CHECK (score BETWEEN 1 AND 10)
+);
+
+CREATE INDEX IF NOT EXISTS movie_ratings_movie_id_idx ON movie_ratings (movie_id);
+
+CREATE TABLE IF NOT EXISTS watchlist_items (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS watchlist_items_movie_id_idx ON watchlist_items (movie_id);
+
+-- A user likes a movie they put on their watchlist or rated highly.
+CREATE OR REPLACE VIEW movie_likes AS
+    SELECT user_id, movie_id FROM watchlist_items
+    UNION
+    SELECT user_id, movie_id FROM movie_ratings WHERE score >= 8;
+
+-- array_jaccard returns the size of the intersection of two arrays over the
+-- size of their union.
+CREATE OR REPLACE FUNCTION array_jaccard(a text[], b text[]) RETURNS real AS $$
+    SELECT COALESCE(
+        (SELECT COUNT(*) FROM (SELECT unnest(a) INTERSECT SELECT unnest(b)) i)::real
+        / NULLIF((SELECT COUNT(*) FROM (SELECT unnest(a) UNION SELECT unnest(b)) u), 0),
+        0)
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE TABLE IF NOT EXISTS similar_movies (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    similar_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    score real NOT NULL,
+    genre_score real NOT NULL,
+    year_score real NOT NULL,
+    people_score real NOT NULL,
+    audience_score real NOT NULL,
+    PRIMARY KEY (movie_id, similar_id)
+);
+
+CREATE INDEX IF NOT EXISTS similar_movies_score_idx ON similar_movies (movie_id, score DESC);
+
+CREATE INDEX IF NOT EXISTS similar_movies_similar_id_idx ON similar_movies (similar_id);
+
+CREATE TABLE IF NOT EXISTS similar_movies_refreshes (
+    movie_id bigint PRIMARY KEY REFERENCES movies ON DELETE CASCADE,
+    refreshed_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
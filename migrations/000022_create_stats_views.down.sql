@@ -0,0 +1,3 @@
+DROP MATERIALIZED VIEW IF EXISTS movie_contributions;
+
+DROP MATERIALIZED VIEW IF EXISTS movie_rating_counts;
\ No newline at end of file
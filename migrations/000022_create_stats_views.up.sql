@@ -0,0 +1,16 @@
+-- The per movie aggregates behind the rating and contributor statistics,
+-- refreshed on a schedule since they scan every rating and revision.
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_rating_counts AS
+    SELECT movie_id, score, COUNT(*) AS ratings
+    FROM movie_ratings
+    GROUP BY movie_id, score;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_rating_counts_key ON movie_rating_counts (movie_id, score);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS movie_contributions AS
+    SELECT movie_id, editor_id, COUNT(*) AS edits
+    FROM movie_revisions
+    WHERE editor_id IS NOT NULL
+    GROUP BY movie_id, editor_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_contributions_key ON movie_contributions (movie_id, editor_id);
\ No newline at end of file
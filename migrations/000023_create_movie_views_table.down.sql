@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS movies_popularity_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS popularity;
+
+DROP TABLE IF EXISTS movie_views;
\ No newline at end of file
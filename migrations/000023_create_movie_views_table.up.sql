@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS movie_views (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    bucket timestamp(0) with time zone NOT NULL,
+    views integer NOT NULL DEFAULT 0,
+    impressions integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (movie_id, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS movie_views_bucket_idx ON movie_views (bucket);
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS popularity real NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS movies_popularity_idx ON movies (popularity DESC, id);
\ No newline at end of file
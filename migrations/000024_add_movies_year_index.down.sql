@@ -0,0 +1 @@
+DROP INDEX IF EXISTS movies_year_idx;
\ No newline at end of file
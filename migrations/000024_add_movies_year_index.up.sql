@@ -0,0 +1,3 @@
+-- Walked from the year of a movie in both directions to find the movies
+-- released around it when refreshing similar movies.
+CREATE INDEX IF NOT EXISTS movies_year_idx ON movies (year, id) WHERE deleted_at IS NULL;
\ No newline at end of file